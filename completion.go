@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/josephvusich/go-getopt"
+)
+
+// Lists dataset names for completion, printing nothing if zfs can't be run
+const completionDatasets = "zfs list -H -o name 2>/dev/null"
+
+type completionFlag struct {
+	long, short string
+	usage       string
+	// file, dataset, or a space-separated list of words; "" for boolean flags
+	arg string
+}
+
+// Returns the flags of the command line, with the values each one takes
+func completionFlags() (flags []completionFlag) {
+	shorts := map[string]string{}
+	for c := 'A'; c <= 'z'; c++ {
+		if f := getopt.CommandLine.Lookup(string(c)); f != nil && f.Name != string(c) {
+			shorts[f.Name] = string(c)
+		}
+	}
+
+	namings := make([]string, 0, len(deviceNamings))
+	for naming := range deviceNamings {
+		if naming != "" {
+			namings = append(namings, naming)
+		}
+	}
+	sort.Strings(namings)
+
+	flag.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		c := completionFlag{long: f.Name, short: shorts[f.Name], usage: usage}
+		switch name {
+		case "":
+		case "file":
+			c.arg = "file"
+		case "pattern":
+			c.arg = "dataset"
+		case "namespace":
+			c.arg = strings.Join(namings, " ")
+		case "shell":
+			c.arg = "fish none sh"
+		default:
+			c.arg = "-"
+		}
+		flags = append(flags, c)
+	})
+	return flags
+}
+
+// Prints a completion script for shell, completing flags and, via zfs list,
+// dataset names
+func printCompletion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		printBashCompletion(w, completionFlags())
+	case "zsh":
+		printZshCompletion(w, completionFlags())
+	case "fish":
+		printFishCompletion(w, completionFlags())
+	default:
+		return fmt.Errorf("unsupported --completion shell %q, expected bash, zsh, or fish", shell)
+	}
+	return nil
+}
+
+func printBashCompletion(w io.Writer, flags []completionFlag) {
+	var names []string
+	cases := map[string][]string{}
+	for _, f := range flags {
+		names = append(names, "--"+f.long)
+		if f.short != "" {
+			names = append(names, "-"+f.short)
+		}
+		if f.arg != "" {
+			cases[f.arg] = append(cases[f.arg], "--"+f.long)
+		}
+	}
+
+	fmt.Fprintln(w, "_zinfer() {")
+	fmt.Fprintln(w, `	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}`)
+	fmt.Fprintln(w, `	case $prev in`)
+	args := make([]string, 0, len(cases))
+	for arg := range cases {
+		args = append(args, arg)
+	}
+	sort.Strings(args)
+	for _, arg := range args {
+		fmt.Fprintf(w, "\t%s)\n", strings.Join(cases[arg], "|"))
+		switch arg {
+		case "file":
+			fmt.Fprintln(w, `		COMPREPLY=($(compgen -f -- "$cur"))`)
+		case "dataset":
+			fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$(%s)\" -- \"$cur\"))\n", completionDatasets)
+		case "-":
+			fmt.Fprintln(w, `		COMPREPLY=()`)
+		default:
+			fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", arg)
+		}
+		fmt.Fprintln(w, "\t\treturn;;")
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if [[ $cur == -* ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$(%s)\" -- \"$cur\"))\n", completionDatasets)
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -F _zinfer zinfer")
+}
+
+func printZshCompletion(w io.Writer, flags []completionFlag) {
+	escape := strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`)
+
+	fmt.Fprintln(w, "#compdef zinfer")
+	fmt.Fprintln(w, "_zinfer_datasets() {")
+	fmt.Fprintln(w, "\tlocal -a names")
+	fmt.Fprintf(w, "\tnames=(${(f)\"$(%s)\"})\n", completionDatasets)
+	fmt.Fprintln(w, "\tcompadd -a names")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "_zinfer() {")
+	fmt.Fprintln(w, "\t_arguments \\")
+	for _, f := range flags {
+		spec := "--" + f.long
+		if f.arg != "" {
+			spec += "="
+		}
+		spec += "[" + escape.Replace(f.usage) + "]"
+		switch f.arg {
+		case "":
+		case "file":
+			spec += ":file:_files"
+		case "dataset":
+			spec = "*" + spec + ":dataset:_zinfer_datasets"
+		case "-":
+			spec += ": "
+		default:
+			spec += ":value:(" + f.arg + ")"
+		}
+		if f.short != "" {
+			fmt.Fprintf(w, "\t\t'(-%s --%s)'{-%s,'%s'} \\\n", f.short, f.long, f.short, spec)
+			continue
+		}
+		fmt.Fprintf(w, "\t\t'%s' \\\n", spec)
+	}
+	fmt.Fprintln(w, "\t\t'*:dataset:_zinfer_datasets'")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "compdef _zinfer zinfer")
+}
+
+func printFishCompletion(w io.Writer, flags []completionFlag) {
+	escape := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+	fmt.Fprintln(w, "function __zinfer_datasets")
+	fmt.Fprintf(w, "\t%s\n", completionDatasets)
+	fmt.Fprintln(w, "end")
+	fmt.Fprintln(w, "complete -c zinfer -f -a '(__zinfer_datasets)'")
+	for _, f := range flags {
+		line := "complete -c zinfer"
+		if f.short != "" {
+			line += " -s " + f.short
+		}
+		line += " -l " + f.long
+		switch f.arg {
+		case "":
+		case "file":
+			line += " -r -F"
+		case "dataset":
+			line += " -x -a '(__zinfer_datasets)'"
+		case "-":
+			line += " -x"
+		default:
+			line += " -x -a '" + f.arg + "'"
+		}
+		fmt.Fprintf(w, "%s -d '%s'\n", line, escape.Replace(f.usage))
+	}
+}
+
+// Returns the shell of a leading --completion shell or --completion=shell
+func completionArg(args []string) (string, bool) {
+	switch {
+	case len(args) == 0:
+		return "", false
+	case args[0] == "--completion":
+		if len(args) < 2 {
+			return "", true
+		}
+		return args[1], true
+	case strings.HasPrefix(args[0], "--completion="):
+		return strings.TrimPrefix(args[0], "--completion="), true
+	default:
+		return "", false
+	}
+}
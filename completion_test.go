@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/josephvusich/go-getopt"
+	"github.com/stretchr/testify/require"
+)
+
+// Runs zinfer --completion shell, returning the script and the flags main
+// registered
+func runCompletion(t *testing.T, shell string) (string, *flag.FlagSet) {
+	assert := require.New(t)
+
+	defer func(fs *flag.FlagSet, g getopt.FlagSet, args []string, stdout *os.File) {
+		flag.CommandLine, getopt.CommandLine, os.Args, os.Stdout = fs, g, args, stdout
+	}(flag.CommandLine, getopt.CommandLine, os.Args, os.Stdout)
+
+	// Free of the flags of the test binary, and of those of earlier runs
+	flags := flag.NewFlagSet("zinfer", flag.ContinueOnError)
+	flag.CommandLine = flags
+	getopt.CommandLine = getopt.FlagSet{FlagSet: flags}
+	os.Args = []string{"zinfer", "--completion", shell}
+
+	f, err := os.CreateTemp(t.TempDir(), "completion")
+	assert.NoError(err)
+	defer f.Close()
+	os.Stdout = f
+	main()
+
+	_, err = f.Seek(0, io.SeekStart)
+	assert.NoError(err)
+	b, err := io.ReadAll(f)
+	assert.NoError(err)
+	return string(b), flags
+}
+
+func TestCompletion(t *testing.T) {
+	assert := require.New(t)
+
+	// Regenerate with go run . --completion bash > testdata/completion.bash
+	golden, err := os.ReadFile("testdata/completion.bash")
+	assert.NoError(err)
+	script, _ := runCompletion(t, "bash")
+	assert.Equal(string(golden), script)
+
+	for shell, option := range map[string]string{"bash": "--%s", "zsh": "--%s", "fish": "-l %s"} {
+		script, flags := runCompletion(t, shell)
+		var n int
+		flags.VisitAll(func(f *flag.Flag) {
+			n++
+			name := strings.Replace(option, "%s", f.Name, 1)
+			assert.Regexp(`(^|[^\w-])`+name+`([^\w-]|$)`, script, "%s completion of --%s", shell, f.Name)
+		})
+		assert.NotZero(n)
+	}
+
+	var w strings.Builder
+	assert.EqualError(printCompletion(&w, "csh"), `unsupported --completion shell "csh", expected bash, zsh, or fish`)
+}
+
+func TestCompletionArg(t *testing.T) {
+	assert := require.New(t)
+
+	for _, tc := range []struct {
+		args  []string
+		shell string
+		ok    bool
+	}{
+		{nil, "", false},
+		{[]string{"--completion", "zsh"}, "zsh", true},
+		{[]string{"--completion=fish"}, "fish", true},
+		{[]string{"--completion"}, "", true},
+		{[]string{"tank", "--completion", "bash"}, "", false},
+	} {
+		shell, ok := completionArg(tc.args)
+		assert.Equal(tc.shell, shell, "%v", tc.args)
+		assert.Equal(tc.ok, ok, "%v", tc.args)
+	}
+}
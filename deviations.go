@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/josephvusich/zinfer/zfs"
+)
+
+// The properties of a dataset that differ from their defaults, see
+// --diff-against-defaults
+type deviations struct {
+	Name       string          `json:"name"`
+	Properties []*zfs.Property `json:"properties"`
+}
+
+// Prints the properties of each dataset indented beneath its name as
+// prop: value (source), separating datasets with a blank line
+func printDeviations(w io.Writer, report []deviations) {
+	for i, d := range report {
+		if i != 0 {
+			fmt.Fprint(w, "\n")
+		}
+		fmt.Fprintln(w, d.Name)
+		for _, p := range d.Properties {
+			fmt.Fprintf(w, "  %s: %s (%s)\n", p.Name, p.Value(), p.Source)
+		}
+	}
+}
+
+func printDeviationsJSON(w io.Writer, report []deviations) error {
+	if report == nil {
+		report = []deviations{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/josephvusich/zinfer/zfs"
+)
+
+// Compares the live pools against a capture in the --stdin format, printing
+// one tab-separated change per line and exiting 1 if there are any
+func diffMain(args []string) {
+	if len(args) != 1 {
+		log.Fatal("usage: zinfer diff capture-file")
+	}
+
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		log.Fatalf("%s is empty", args[0])
+	}
+
+	input, err := splitCapture(b)
+	if err != nil {
+		log.Fatalf("%s: %s", args[0], err)
+	}
+	input.Unordered = true
+
+	captured, err := zfs.ImportedPoolsFrom(input)
+	if err != nil {
+		log.Fatalf("captured input: %s", err)
+	}
+
+	live, err := zfs.ImportedPools()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	changes := zfs.Diff(captured, live)
+	for _, c := range changes {
+		fmt.Println(strings.Join([]string{string(c.Kind), c.Type, c.Name, c.Property, c.Old, c.New}, "\t"))
+	}
+	if len(changes) != 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/josephvusich/zinfer/zfs"
+)
+
+// Prints the commands and asks on stderr whether to run them
+func confirm(commands []zfs.Command, in io.Reader, format textFormat) bool {
+	printText(os.Stdout, commands, format)
+	fmt.Fprintf(os.Stderr, "\nrun %d commands? [y/N] ", len(commands))
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// Runs the commands in order, stopping at the first failure so that nothing
+// is created in a pool or dataset that failed to be created
+func executeCommands(r zfs.CommandRunner, commands []zfs.Command) error {
+	for _, c := range commands {
+		if _, err := r.Run(c.Argv[0], c.Argv[1:]...); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && len(exitErr.Stderr) != 0 {
+				err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return fmt.Errorf("%s failed: %w", c.Oneline(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/josephvusich/zinfer/zfs"
+	"github.com/stretchr/testify/require"
+)
+
+// Records each command run, failing those in fail
+type recordingRunner struct {
+	ran  [][]string
+	fail map[string]error
+}
+
+func (r *recordingRunner) Run(name string, args ...string) ([]byte, error) {
+	argv := append([]string{name}, args...)
+	r.ran = append(r.ran, argv)
+	return nil, r.fail[strings.Join(argv, " ")]
+}
+
+func TestExecuteCommands(t *testing.T) {
+	assert := require.New(t)
+
+	commands := []zfs.Command{
+		{Kind: zfs.CommandPool, Target: "tank", Argv: []string{"zpool", "create", "-O", "org:note=two  spaces", "tank", "/dev/sda"}},
+		{Kind: zfs.CommandDataset, Target: "tank/a", Argv: []string{"zfs", "create", "-o", "mountpoint=/srv/a b", "tank/a"}},
+		{Kind: zfs.CommandDataset, Target: "tank/a/b", Argv: []string{"zfs", "create", "tank/a/b"}},
+	}
+
+	// Argv is passed through unquoted and unchanged
+	r := &recordingRunner{}
+	assert.NoError(executeCommands(r, commands))
+	assert.Equal([][]string{commands[0].Argv, commands[1].Argv, commands[2].Argv}, r.ran)
+
+	// Nothing runs after the first failure
+	r = &recordingRunner{fail: map[string]error{
+		"zfs create -o mountpoint=/srv/a b tank/a": errors.New("exit status 1"),
+	}}
+	err := executeCommands(r, commands)
+	assert.EqualError(err, "zfs create -o 'mountpoint=/srv/a b' tank/a failed: exit status 1")
+	assert.Equal([][]string{commands[0].Argv, commands[1].Argv}, r.ran)
+
+	// The stderr of a failed command is included
+	r = &recordingRunner{fail: map[string]error{
+		"zpool create -O org:note=two  spaces tank /dev/sda": &exec.ExitError{Stderr: []byte("cannot create 'tank': pool already exists\n")},
+	}}
+	err = executeCommands(r, commands)
+	assert.Error(err)
+	assert.True(strings.HasSuffix(err.Error(), ": cannot create 'tank': pool already exists"), err.Error())
+	assert.Len(r.ran, 1)
+}
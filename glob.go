@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// Reports whether a requested name is a pattern rather than an exact name
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, `*?[\`)
+}
+
+// Reports any malformed path.Match syntax in pattern
+func validateGlob(pattern string) error {
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the first pattern matching name, or "" if there is none
+func matchingGlob(patterns []string, name string) string {
+	for _, pattern := range patterns {
+		if matchGlob(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// Matches name element by element with path.Match, except that a ** element
+// matches any number of levels, including none
+func matchGlob(pattern, name []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlob(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	assert := require.New(t)
+
+	for _, tc := range []struct {
+		pattern, name string
+		matches       bool
+	}{
+		{"tank", "tank", true},
+		{"tank", "tank/a", false},
+		{"tank/*", "tank/a", true},
+		{"tank/*", "tank", false},
+		{"tank/*", "tank/a/b", false},
+		{"tank/a?", "tank/ab", true},
+		{"tank/[ab]", "tank/c", false},
+		// ** matches any number of levels, including none
+		{"tank/**", "tank", true},
+		{"tank/**", "tank/a/b/c", true},
+		{"**", "tank", true},
+		{"**", "tank/a/b", true},
+		{"**/b", "b", true},
+		{"**/b", "tank/a/b", true},
+		{"**/b", "tank/a/c", false},
+		{"tank/**/c", "tank/c", true},
+		{"tank/**/c", "tank/a/b/c", true},
+		{"tank/**/c", "tank/a/b", false},
+		{"tank/**/**", "tank/a", true},
+		// * doesn't cross levels, and elements must all be matched
+		{"*", "tank/a", false},
+		{"tank/a/b", "tank/a", false},
+		{"tank/*/*", "tank/a", false},
+		{"tank/a", "tank/a/b", false},
+		// Empty elements only match each other
+		{"tank//a", "tank//a", true},
+		{"tank//a", "tank/a", false},
+		{"tank/*/a", "tank//a", true},
+		{"tank/", "tank", false},
+		{"", "", true},
+		{"", "tank", false},
+	} {
+		matches := matchGlob(strings.Split(tc.pattern, "/"), strings.Split(tc.name, "/"))
+		assert.Equal(tc.matches, matches, "%q against %q", tc.pattern, tc.name)
+	}
+}
+
+func TestMatchingGlob(t *testing.T) {
+	assert := require.New(t)
+
+	patterns := []string{"tank/*", "tank/**", "other"}
+	assert.Equal("tank/*", matchingGlob(patterns, "tank/a"))
+	assert.Equal("tank/**", matchingGlob(patterns, "tank/a/b"))
+	assert.Equal("other", matchingGlob(patterns, "other"))
+	assert.Equal("", matchingGlob(patterns, "other/a"))
+	assert.Equal("", matchingGlob(nil, "tank"))
+
+	assert.True(isGlob("tank/*"))
+	assert.True(isGlob(`tank/\a`))
+	assert.False(isGlob("tank/a"))
+	assert.NoError(validateGlob("tank/**/[ab]"))
+	assert.Error(validateGlob("tank/[a"))
+}
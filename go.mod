@@ -4,8 +4,14 @@ go 1.18
 
 require (
 	github.com/josephvusich/go-getopt v1.0.0
-	github.com/josephvusich/go-zfs v0.0.0-20221204011308-643917c7dc71
+	github.com/stretchr/testify v1.7.0
+	golang.org/x/sync v0.1.0
 	gopkg.in/alessio/shellescape.v1 v1.0.0-20170105083845-52074bc9df61
 )
 
-require github.com/alessio/shellescape v1.4.1 // indirect
+require (
+	github.com/alessio/shellescape v1.4.1 // indirect
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
@@ -1,122 +1,920 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
-	"regexp"
+	"runtime/debug"
 	"sort"
 	"strings"
+	"text/template"
+	"time"
+	"unicode"
 
 	"github.com/josephvusich/go-getopt"
-	"github.com/josephvusich/go-zfs"
-	"gopkg.in/alessio/shellescape.v1"
+	"github.com/josephvusich/zinfer/zfs"
 )
 
 func main() {
 	log.SetFlags(0)
 
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		diffMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		statsMain(os.Args[2:])
+		return
+	}
+
 	minimalFeatures := flag.Bool("minimal-features", false, "omit enabled pool features that are not currently active")
+	preserveActive := flag.Bool("preserve-active", false, "note the pool features that are active, not merely enabled, in a comment after zpool create")
+	altroot := flag.Bool("altroot", false, "emit the altroot pools are currently imported with")
+	deviceNaming := flag.String("device-naming", "", "rename leaf devices into the `namespace` dev, id, path, or vdev")
+	jsonOutput := flag.Bool("json", false, "print commands as a JSON array of unescaped argv")
+	script := flag.Bool("script", false, "print commands as a runnable bash script")
+	diffAgainstDefaults := flag.Bool("diff-against-defaults", false, "instead of commands, list the properties of each dataset that differ from their defaults, with their sources")
+	templateFile := flag.String("template", "", "render the commands with the Go text/template in `file`, see the README")
+	output := flag.String("output", "", "write the output to `file`, replacing it only once the output is complete")
+	zfsGetFile := flag.String("zfs-get-file", "", "read captured zfs get all output from `file` instead of running zfs")
+	zpoolGetFile := flag.String("zpool-get-file", "", "read captured zpool get all output from `file` instead of running zpool")
+	zpoolStatusFile := flag.String("zpool-status-file", "", "read captured zpool status -P output from `file` to include vdevs with captured input")
+	stdin := flag.Bool("stdin", false, "read captured zfs get all, zpool get all, and optionally zpool status -P output from stdin, separated by --- lines")
+	snapshots := flag.Bool("snapshots", false, "recreate snapshots after their datasets, in order of creation")
+	bookmarks := flag.Bool("bookmarks", false, "recreate bookmarks from their source snapshots; requires --snapshots")
+	holds := flag.Bool("holds", false, "recreate user holds on snapshots; requires --snapshots")
+	onlyLocal := flag.Bool("only-local", false, "only emit locally set properties, the minimum to reproduce deliberate choices")
+	noReceived := flag.Bool("no-received", false, "omit properties set by zfs receive")
+	noUserProperties := flag.Bool("no-user-properties", false, "omit user properties such as com.example:backup")
+	noShares := flag.Bool("no-shares", false, "omit sharenfs and sharesmb, for exports managed elsewhere")
+	loadKeys := flag.Bool("load-key", false, "follow the zpool import of --import with zfs load-key of each encryption root, see --keylocation")
+	explicitInherit := flag.Bool("explicit-inherit", false, "follow each dataset with zfs inherit for its inherited properties")
+	noMount := flag.Bool("no-mount", false, "create filesystems with zfs create -u so they are not mounted; zpool create still mounts each pool root")
+	destroy := flag.Bool("destroy", false, "print the commands destroying the selected datasets and pools instead of creating them")
+	confirmDestroy := flag.Bool("confirm-destroy", false, "allow --destroy to be combined with --execute")
+	importPool := flag.Bool("import", false, "follow each pool with the zpool import command that finds its devices, for use after export")
+	createParents := flag.Bool("create-parents", false, "pass -p to zfs create, leaving out ancestors it would create identically")
+	mkdir := flag.Bool("mkdir", false, "precede each dataset with a mkdir -p of its locally set mountpoint")
+	permissions := flag.Bool("permissions", false, "recreate permissions delegated with zfs allow; runs zfs allow once per dataset")
+	parseable := flag.Bool("parseable", false, "run zfs get -p and zpool get -p so numeric values are exact")
+	jsonInput := flag.Bool("json-input", false, "run zfs get -j and zpool get -j even if the installed zfs is not known to support them")
+	partialInput := flag.Bool("partial-input", false, "tolerate properties inherited from datasets missing from the input, emitting them as local")
+	continueOnError := flag.Bool("continue-on-error", false, "skip malformed zfs get all lines with a warning instead of failing")
+	validate := flag.Bool("validate", false, "list configuration that can't be faithfully recreated and exit 1 if there is any, instead of printing commands")
+	var poolNames stringList
+	flag.Var(&poolNames, "pool", "only include the pool `name`; may be repeated")
+	var excludes stringList
+	flag.Var(&excludes, "exclude", "omit datasets matching `pattern`, and with --recursive their descendants; may be repeated")
+	var onlyProperties stringList
+	flag.Var(&onlyProperties, "only-property", "only emit the property `name`, leaving all others at their defaults; may be repeated")
+	var skipProperties stringList
+	flag.Var(&skipProperties, "skip-property", "never emit the property `name`, such as one managed elsewhere; may be repeated and overrides --only-property")
+	var where whereFlag
+	flag.Var(&where, "where", "only include datasets whose property has a value, as in `prop=value`, prop!=value, or prop=prefix*; may be repeated, and all must match")
+	keyLocations := keyLocationFlag{}
+	flag.Var(keyLocations, "keylocation", "replace keylocation=prompt with `uri`, such as file:///root/key, or with dataset=uri only on that encryption root; may be repeated")
 	recursive := flag.Bool("recursive", false, "recursively include descendant datasets of the specified parents")
+	maxDepth := flag.Int("max-depth", -1, "with --recursive, include descendants at most `N` levels below the specified parents, or all of them if negative")
+	verbose := flag.Bool("verbose", false, "explain on stderr why each property was omitted, and note settings that may not work as intended")
+	execute := flag.Bool("execute", false, "run the inferred commands, stopping at the first failure; asks for confirmation unless --yes is given")
+	yes := flag.Bool("yes", false, "run the commands of --execute without asking for confirmation")
+	dryRun := flag.Bool("dry-run", false, "only print the commands, even if --execute is given; this is the default")
+	prefix := flag.String("prefix", "", "precede each command with the space-separated `words`, such as doas or \"sudo -n\"")
+	oneline := flag.Bool("oneline", false, "print each command on a single line, without line continuations")
+	annotateProperties := flag.Bool("annotate-properties", false, "follow each property with a comment giving its source; ignored with --oneline")
+	suggestInheritance := flag.Bool("suggest-inheritance", false, "follow the commands with comments suggesting properties that sibling datasets all set, which their parent could set instead")
+	annotate := flag.Bool("annotate", false, "precede the commands of each pool and dataset with a comment describing it")
+	quote := flag.String("quote", "sh", "quote arguments for the `shell` sh, fish, or none")
+	sudo := flag.Bool("sudo", false, "precede each command with sudo, the same as --prefix sudo")
 	help := flag.Bool("help", false, "show this help message")
 	getopt.Alias("R", "recursive")
+	getopt.Alias("w", "output")
+
+	// Hidden from --help, so handled before parsing
+	if shell, ok := completionArg(os.Args[1:]); ok {
+		if err := printCompletion(os.Stdout, shell); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if err := getopt.CommandLine.Parse(os.Args[1:]); err != nil {
 		log.Fatal(err)
 	}
 
 	if *help {
-		fmt.Fprintln(flag.CommandLine.Output(), "usage: zinfer [--minimal-features] [--recursive] [dataset ...]")
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: zinfer [options] [dataset ...]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       zinfer diff capture-file")
+		fmt.Fprintln(flag.CommandLine.Output(), "       zinfer stats [--json] [capture-file]")
 		getopt.PrintDefaults()
 		os.Exit(0)
 	}
 
-	requested := map[string]struct{}{}
-	requestedPrefix := map[string]struct{}{}
-	for _, name := range flag.Args() {
-		requested[name] = struct{}{}
-		requestedPrefix[name] = struct{}{}
+	if *verbose {
+		zfs.Omitf = log.Printf
+		zfs.Advisef = func(format string, v ...interface{}) {
+			log.Printf("note: "+format, v...)
+		}
 	}
 
-	if *recursive && len(requestedPrefix) == 0 {
-		log.Fatal("--recursive flag requires at least one parent dataset to be specified")
+	if *jsonOutput && *script {
+		log.Fatal("--json and --script are mutually exclusive")
+	}
+
+	if *templateFile != "" && (*jsonOutput || *script || *annotate || *suggestInheritance) {
+		log.Fatal("--template cannot be combined with --json, --script, --annotate, or --suggest-inheritance")
+	}
+
+	if *diffAgainstDefaults && (*script || *templateFile != "" || *destroy || *annotate || *suggestInheritance) {
+		log.Fatal("--diff-against-defaults cannot be combined with --script, --template, --destroy, --annotate, or --suggest-inheritance")
+	}
+
+	if *dryRun {
+		*execute = false
+	}
+
+	if *execute && (*jsonOutput || *script || *templateFile != "") {
+		log.Fatal("--execute cannot be combined with --json, --script, or --template")
+	}
+
+	if *execute && *diffAgainstDefaults {
+		log.Fatal("--execute cannot be combined with --diff-against-defaults")
+	}
+
+	if *execute && *output != "" {
+		log.Fatal("--execute cannot be combined with --output")
+	}
+
+	if *execute && *destroy && !*confirmDestroy {
+		log.Fatal("--destroy with --execute also requires --confirm-destroy")
+	}
+
+	if *loadKeys && !*importPool {
+		log.Fatal("--load-key requires --import, as zfs create leaves keys loaded")
+	}
+
+	if *execute && *importPool {
+		log.Fatal("--import cannot be combined with --execute, created pools are already imported")
+	}
+
+	if *execute && *stdin && !*yes {
+		log.Fatal("--execute with --stdin requires --yes, as stdin is not available for confirmation")
+	}
+
+	quoter, ok := quoters[*quote]
+	if !ok {
+		log.Fatalf("unsupported --quote %s, expected sh, fish, or none", *quote)
+	}
+	if *script && *quote != "sh" {
+		log.Fatal("--script requires --quote sh, as it prints a bash script")
+	}
+	if *annotate && *jsonOutput {
+		log.Fatal("--annotate cannot be combined with --json")
+	}
+	if *suggestInheritance && *jsonOutput {
+		log.Fatal("--suggest-inheritance cannot be combined with --json")
+	}
+	if *annotateProperties && *quote != "sh" {
+		log.Fatal("--annotate-properties requires --quote sh, as its comments are command substitutions")
+	}
+	format := textFormat{quoter: quoter, oneline: *oneline}
+
+	var tmpl *template.Template
+	if *templateFile != "" {
+		text, err := os.ReadFile(*templateFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if tmpl, err = zfs.ParseTemplate(path.Base(*templateFile), string(text)); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	pools, err := zfs.ImportedPools()
+	if *sudo {
+		if *prefix != "" {
+			log.Fatal("--sudo and --prefix are mutually exclusive")
+		}
+		*prefix = "sudo"
+	}
+
+	if *bookmarks && !*snapshots {
+		log.Fatal("--bookmarks requires --snapshots")
+	}
+
+	if *holds && !*snapshots {
+		log.Fatal("--holds requires --snapshots")
+	}
+
+	naming, ok := deviceNamings[*deviceNaming]
+	if !ok {
+		log.Fatalf("unknown --device-naming: %s", *deviceNaming)
+	}
+
+	sel, err := newSelection(flag.Args(), excludes, *recursive, *maxDepth)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sortedPools := make([]string, 0, len(pools))
-	for _, p := range pools {
-		sortedPools = append(sortedPools, p.Name)
+	if *recursive && flag.NArg() == 0 {
+		log.Fatal("--recursive flag requires at least one parent dataset to be specified")
+	}
+	if *maxDepth >= 0 && !*recursive {
+		log.Fatal("--max-depth requires --recursive")
 	}
-	sort.Strings(sortedPools)
 
-	printed := 0
-	print := func(p *zfs.Pool, name string, isPool bool) {
-		if len(requestedPrefix) != 0 {
-			if _, ok := requested[name]; ok {
-				delete(requested, name)
-			} else if *recursive {
-				if _, ok := requestedPrefix[path.Dir(name)]; !ok {
-					return
-				}
-				requestedPrefix[name] = struct{}{}
+	var input *zfs.Input
+	if *stdin {
+		if *zfsGetFile != "" || *zpoolGetFile != "" || *zpoolStatusFile != "" {
+			log.Fatal("--stdin cannot be combined with captured input files")
+		}
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if input, err = splitCapture(b); err != nil {
+			log.Fatalf("--stdin: %s", err)
+		}
+	} else if *zfsGetFile != "" || *zpoolGetFile != "" {
+		if *zfsGetFile == "" || *zpoolGetFile == "" {
+			log.Fatal("--zfs-get-file and --zpool-get-file must be specified together")
+		}
+		input = &zfs.Input{
+			ZfsGetAll:   streamCapture("zfs-get-file", *zfsGetFile),
+			ZpoolGetAll: readCapture("zpool-get-file", *zpoolGetFile),
+		}
+		if *zpoolStatusFile != "" {
+			input.ZpoolStatus = readCapture("zpool-status-file", *zpoolStatusFile)
+		}
+	} else if *zpoolStatusFile != "" {
+		log.Fatal("--zpool-status-file requires --zfs-get-file and --zpool-get-file")
+	}
+
+	captured := input != nil
+	switch {
+	case captured && *permissions:
+		log.Fatal("--permissions cannot be combined with captured input")
+	case captured && *holds:
+		log.Fatal("--holds cannot be combined with captured input")
+	case captured && *deviceNaming != "":
+		log.Fatal("--device-naming cannot be combined with captured input, as device links are resolved on this host")
+	case captured && *parseable:
+		log.Fatal("--parseable cannot be combined with captured input, capture with zfs get -p and zpool get -p instead")
+	case captured && *jsonInput:
+		log.Fatal("--json-input cannot be combined with captured input, captured json is detected automatically")
+	case *parseable && *jsonInput:
+		log.Fatal("--parseable and --json-input are mutually exclusive")
+	case captured:
+	case *parseable:
+		input = zfs.ParseableInput(zfs.DefaultRunner)
+	case *jsonInput:
+		if v, err := zfs.ZfsVersion(); err != nil {
+			log.Printf("warning: --json-input requested, but the zfs version is unknown: %s", err)
+		} else if !v.SupportsJSON() {
+			log.Printf("warning: --json-input requested, but zfs %s does not support get -j", v)
+		}
+		input = zfs.JSONInput(zfs.DefaultRunner)
+	default:
+		// Prefer structured output where the installed zfs supports it
+		input = zfs.DetectInput(zfs.DefaultRunner)
+	}
+	if *holds {
+		input.ZfsHolds = zfs.HoldsRunner(zfs.DefaultRunner)
+	}
+	if *permissions {
+		input.ZfsAllow = zfs.AllowRunner(zfs.DefaultRunner)
+	}
+	if captured {
+		// Check the captured features against the zfs the commands would run on
+		input.ZfsVersion = zfs.ZfsVersion
+	}
+	input.ContinueOnError = *continueOnError
+	input.PartialInput = *partialInput
+	// Captures may have been edited by hand
+	input.Unordered = captured
+
+	pools, err := zfs.ImportedPoolsFrom(input)
+	if errs, ok := err.(zfs.ParseErrors); ok {
+		for _, e := range errs {
+			log.Printf("warning: skipped %s", e)
+		}
+		err = nil
+	}
+	if err != nil {
+		if captured {
+			log.Fatalf("captured input: %s", err)
+		}
+		log.Fatal(err)
+	}
+
+	if len(poolNames) != 0 {
+		selected := map[string]*zfs.Pool{}
+		for _, name := range poolNames {
+			if p, ok := pools[name]; ok {
+				selected[name] = p
 			} else {
-				return
+				fmt.Fprintf(os.Stderr, "pool not found: %s\n", name)
 			}
 		}
-		if printed != 0 {
-			fmt.Print("\n")
+		pools = selected
+	}
+
+	for name := range keyLocations {
+		if name != "" && !anyEncryptionRoot(pools, name) {
+			log.Printf("warning: --keylocation %s is not an encryption root, ignoring it", name)
+		}
+	}
+
+	if *validate {
+		concerns := zfs.Validate(pools)
+		for _, c := range concerns {
+			fmt.Println(c)
+		}
+		if len(concerns) != 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	sortedPools := zfs.OrderPools(pools)
+
+	opts := &zfs.FlagOptions{
+		DisableAllFeatures: true,
+		MinimalFeatures:    *minimalFeatures,
+		PreserveActive:     *preserveActive,
+		AnnotateProperties: *annotateProperties,
+		DeviceNaming:       naming,
+		Clones:             *snapshots,
+		NoMount:            *noMount,
+		IncludeAltroot:     *altroot,
+		IncludeReceived:    !*noReceived,
+		CreateParents:      *createParents,
+		IncludeProperties:  onlyProperties,
+		ExcludeProperties:  skipProperties,
+		OnlyLocal:          *onlyLocal,
+		NoUserProperties:   *noUserProperties,
+		NoShares:           *noShares,
+		KeyLocations:       keyLocations,
+		LoadKeys:           *loadKeys,
+		ExplicitInherit:    *explicitInherit,
+		Snapshots:          *snapshots,
+		Holds:              *holds,
+		Bookmarks:          *bookmarks,
+	}
+
+	var commands []zfs.Command
+	var suggestions []zfs.Suggestion
+	var report []deviations
+	recreated := map[string]struct{}{}
+	// Reports whether name is selected and not excluded, which must be
+	// called for parents before their children
+	include := func(p *zfs.Pool, name string, isPool bool) bool {
+		if !sel.selects(name) {
+			return false
+		}
+		if sel.excludes(name) {
+			if !isPool && !*destroy && isEncryptionRoot(p, name) {
+				log.Printf("warning: excluding encryption root %s, datasets encrypted under it can't be recreated", name)
+			}
+			return false
+		}
+		// The pool root is kept for its descendants, unless it would be destroyed
+		if len(where) != 0 && (!isPool || *destroy) && !where.matches(p.Datasets.Index[name]) {
+			return false
+		}
+		return true
+	}
+
+	print := func(p *zfs.Pool, name string, isPool bool) {
+		if !include(p, name, isPool) {
+			return
 		}
-		printed++
-		var cmd []string
-		var err error
-		if isPool {
-			cmd, err = p.CreatePoolCommand(&zfs.FlagOptions{MinimalFeatures: *minimalFeatures})
-		} else {
-			cmd, err = p.CreateDatasetCommand(name)
+		if *mkdir && !isPool {
+			if dir, ok := localMountpoint(p.Datasets.Index[name]); ok {
+				commands = append(commands, zfs.Command{Kind: commandMkdir, Target: name, Argv: []string{"mkdir", "-p", dir}})
+			}
 		}
+
+		cmds, err := p.CommandsFor(name, opts)
 		if err != nil {
 			log.Fatal(err)
 		}
-		fmt.Println(escapeCommand(cmd))
+		for _, c := range cmds {
+			if origin := c.Origin(); origin != "" {
+				if _, ok := recreated[origin]; !ok {
+					log.Printf("warning: origin %s of clone %s is not part of the output, the clone can't be reproduced without it", origin, name)
+				}
+			}
+			switch c.Kind {
+			case zfs.CommandPool, zfs.CommandDataset, zfs.CommandSnapshot:
+				recreated[c.Target] = struct{}{}
+			}
+		}
+		commands = append(commands, cmds...)
 	}
 
 	for _, poolName := range sortedPools {
 		p := pools[poolName]
 
+		if *destroy {
+			var names []string
+			p.WalkDatasets(func(d *zfs.Dataset) error {
+				if include(p, d.Name, d.Name == poolName) {
+					names = append(names, d.Name)
+				}
+				return nil
+			})
+			cmds, err := p.DestroyCommands(names)
+			if err != nil {
+				log.Fatalf("%s: %s", poolName, err)
+			}
+			for _, cmd := range cmds {
+				commands = append(commands, zfs.Command{Kind: zfs.CommandDestroy, Target: cmd[len(cmd)-1], Argv: cmd})
+			}
+			continue
+		}
+
+		if *diffAgainstDefaults {
+			p.WalkDatasets(func(d *zfs.Dataset) error {
+				if include(p, d.Name, d.Name == poolName) {
+					if props := d.NonDefaultProperties(); len(props) != 0 {
+						report = append(report, deviations{Name: d.Name, Properties: props})
+					}
+				}
+				return nil
+			})
+			continue
+		}
+
+		start := len(commands)
 		print(p, poolName, true)
 
-		for i, d := range p.Datasets.Ordered {
-			if i == 0 {
+		// Clones must follow the dataset holding their origin snapshot
+		datasets := p.Datasets.Ordered
+		if opts.Clones {
+			if datasets, err = p.OrderedDatasets(); err != nil {
+				log.Fatalf("%s: %s", poolName, err)
+			}
+		}
+
+		for _, d := range datasets {
+			if d.Name == poolName {
 				continue
 			}
 
 			print(p, d.Name, false)
 		}
+		commands = append(commands[:start], p.DropImplied(commands[start:], opts)...)
+
+		if _, ok := recreated[poolName]; ok && p.Bootfs() != "" {
+			if _, ok := recreated[p.Bootfs()]; !ok {
+				log.Printf("warning: bootfs %s of %s is not part of the output, it will not be set", p.Bootfs(), poolName)
+			}
+		}
+
+		if *suggestInheritance {
+			suggestions = append(suggestions, recreatedSuggestions(p, recreated)...)
+		}
+
+		if _, ok := recreated[poolName]; ok && *importPool {
+			var names []string
+			for _, d := range p.Datasets.Ordered {
+				if _, ok := recreated[d.Name]; ok {
+					names = append(names, d.Name)
+				}
+			}
+			cmds, err := p.ImportCommands(names, opts)
+			if err != nil {
+				log.Fatalf("%s: %s", poolName, err)
+			}
+			commands = append(commands, cmds...)
+		}
+	}
+
+	if words := strings.Fields(*prefix); len(words) != 0 {
+		for i := range commands {
+			commands[i] = commands[i].WithPrefix(words...)
+		}
+	}
+
+	if *annotate {
+		format.annotate = pools
+	}
+
+	// Written to --output at once, so that a failure leaves any previous file intact
+	var out io.Writer = os.Stdout
+	var buf bytes.Buffer
+	if *output != "" {
+		out = &buf
+	}
+
+	switch {
+	case *execute:
+	case *diffAgainstDefaults && *jsonOutput:
+		if err := printDeviationsJSON(out, report); err != nil {
+			log.Fatal(err)
+		}
+	case *diffAgainstDefaults:
+		printDeviations(out, report)
+	case *jsonOutput:
+		if err := printJSON(out, commands); err != nil {
+			log.Fatal(err)
+		}
+	case tmpl != nil:
+		if err := tmpl.Execute(out, zfs.TemplateData{Commands: commands, Pools: pools}); err != nil {
+			log.Fatal(err)
+		}
+	case *script:
+		printScript(out, commands, format)
+		printSuggestions(out, suggestions, len(commands) != 0)
+	default:
+		printText(out, commands, format)
+		printSuggestions(out, suggestions, len(commands) != 0)
 	}
 
-	if len(requested) != 0 {
-		if printed != 0 {
+	if *output != "" {
+		perm := os.FileMode(0644)
+		if *script {
+			perm = 0755
+		}
+		if err := writeFileAtomic(*output, buf.Bytes(), perm); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(sel.requested) != 0 {
+		if !*jsonOutput && !*execute && *output == "" && (len(commands) != 0 || len(report) != 0) {
 			fmt.Print("\n")
 		}
-		for missing := range requested {
+		for missing := range sel.requested {
 			fmt.Fprintf(os.Stderr, "filesystem not found: %s\n", missing)
 		}
 	}
+	for _, f := range where {
+		if !f.matched {
+			log.Printf("note: --where %s matched no datasets", f)
+		}
+	}
+
+	if *execute && len(commands) != 0 {
+		if !*yes && !confirm(commands, os.Stdin, format) {
+			log.Fatal("aborted")
+		}
+		if err := executeCommands(zfs.DefaultRunner, commands); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Reports whether other datasets in p inherit their encryption from name
+func isEncryptionRoot(p *zfs.Pool, name string) bool {
+	for _, d := range p.Datasets.Ordered {
+		if er, ok := d.Properties["encryptionroot"]; ok && d.Name != name && er.Value() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether name is an encryption root in any of pools
+func anyEncryptionRoot(pools map[string]*zfs.Pool, name string) bool {
+	for _, p := range pools {
+		if d, ok := p.Datasets.Index[name]; ok {
+			return d.IsEncryptionRoot()
+		}
+	}
+	return false
+}
+
+// Returns the mountpoint of d if it is an explicit path set on d itself
+func localMountpoint(d *zfs.Dataset) (string, bool) {
+	prop, ok := d.Properties["mountpoint"]
+	if !ok || prop.Source.Location != zfs.PropertyLocal {
+		return "", false
+	}
+	switch dir := prop.Value(); dir {
+	case "legacy", "none":
+		return "", false
+	default:
+		return dir, strings.HasPrefix(dir, "/")
+	}
+}
+
+// Returns a reader for the file passed to flagName
+func readCapture(flagName, file string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %w", flagName, err)
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			return nil, fmt.Errorf("--%s: %s is empty", flagName, file)
+		}
+		return b, nil
+	}
+}
+
+// Returns the file passed to flagName, to be read as it is parsed
+func streamCapture(flagName, file string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %w", flagName, err)
+		}
+		r := bufio.NewReader(f)
+		for {
+			c, err := r.ReadByte()
+			if err == io.EOF {
+				f.Close()
+				return nil, fmt.Errorf("--%s: %s is empty", flagName, file)
+			} else if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("--%s: %w", flagName, err)
+			}
+			if !unicode.IsSpace(rune(c)) {
+				r.UnreadByte()
+				break
+			}
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{r, f}, nil
+	}
+}
+
+// Separates the sections of a capture read by --stdin
+const captureSentinel = "---"
+
+// Commands whose output makes up each section of a capture
+var captureSections = []string{"zfs get all", "zpool get all", "zpool status -P"}
+
+// Splits a combined capture into zfs get all, zpool get all, and an optional
+// zpool status -P section, each separated by a line containing only ---
+func splitCapture(b []byte) (*zfs.Input, error) {
+	var sections [][]byte
+	var current []byte
+	for _, l := range bytes.SplitAfter(b, []byte{'\n'}) {
+		if string(bytes.TrimSpace(l)) == captureSentinel {
+			sections = append(sections, current)
+			current = nil
+			continue
+		}
+		current = append(current, l...)
+	}
+	sections = append(sections, current)
+
+	if len(sections) != 2 && len(sections) != 3 {
+		return nil, fmt.Errorf("expected 2 or 3 sections separated by %s lines, found %d", captureSentinel, len(sections))
+	}
+	for i, section := range sections {
+		if len(bytes.TrimSpace(section)) == 0 {
+			return nil, fmt.Errorf("%s section is empty", captureSections[i])
+		}
+	}
+
+	section := func(i int) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			return sections[i], nil
+		}
+	}
+
+	input := &zfs.Input{
+		ZfsGetAll: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(sections[0])), nil
+		},
+		ZpoolGetAll: section(1),
+	}
+	if len(sections) == 3 {
+		input.ZpoolStatus = section(2)
+	}
+	return input, nil
+}
+
+// Creates the local mountpoint of a dataset, see --mkdir
+const commandMkdir zfs.CommandKind = "mkdir"
+
+var quoters = map[string]zfs.Quoter{
+	"sh":   zfs.QuoteSh,
+	"fish": zfs.QuoteFish,
+	"none": zfs.QuoteNone,
+}
+
+// How printText formats each command
+type textFormat struct {
+	quoter  zfs.Quoter
+	oneline bool
+	// Pools to describe in comments preceding their commands, if not nil
+	annotate map[string]*zfs.Pool
+}
+
+// Separates multiline commands, and with annotations the commands of each
+// pool, with a blank line
+func printText(w io.Writer, commands []zfs.Command, format textFormat) {
+	var pool, dataset string
+	for i, c := range commands {
+		name := poolName(c.Target)
+		newPool := format.annotate != nil && name != pool
+		if i != 0 && (!format.oneline || newPool) {
+			fmt.Fprint(w, "\n")
+		}
+		if newPool {
+			pool = name
+			fmt.Fprintf(w, "# pool: %s\n", describePool(name, format.annotate[name]))
+		}
+		if format.annotate != nil && (c.Kind == zfs.CommandDataset || c.Kind == commandMkdir) && c.Target != dataset {
+			dataset = c.Target
+			fmt.Fprintf(w, "# dataset: %s\n", dataset)
+		}
+		line := c.Format(format.quoter, !format.oneline)
+		if c.Comment != "" {
+			line += "  # " + c.Comment
+		}
+		fmt.Fprintln(w, line)
+	}
 }
 
-var oPattern = regexp.MustCompile(`^-[oO]$`)
+// Returns the pool of a dataset, snapshot, or bookmark name
+func poolName(name string) string {
+	if i := strings.IndexAny(name, "/@#"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
 
-func escapeCommand(cmd []string) string {
-	for i := range cmd {
-		cmd[i] = shellescape.Quote(cmd[i])
-		if oPattern.MatchString(cmd[i]) || len(cmd)-1 == i {
-			cmd[i] = "\\\n  " + cmd[i]
+// Returns name with the number of datasets and enabled features of p
+func describePool(name string, p *zfs.Pool) string {
+	if p == nil {
+		return name
+	}
+	features := 0
+	for _, prop := range p.Properties {
+		if strings.HasPrefix(prop.Name, "feature@") && prop.Value() != zfs.FeatureDisabled {
+			features++
 		}
 	}
-	return strings.Join(cmd, " ")
+	return fmt.Sprintf("%s (%s, %s)", name, plural(len(p.Datasets.Ordered), "dataset"), plural(features, "feature"))
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// Minimum number of siblings for --suggest-inheritance
+const suggestMinChildren = 2
+
+// Returns the suggestions for p whose datasets are all recreated
+func recreatedSuggestions(p *zfs.Pool, recreated map[string]struct{}) (suggestions []zfs.Suggestion) {
+	for _, s := range p.SuggestInheritance(suggestMinChildren) {
+		all := true
+		for _, name := range append([]string{s.Parent}, s.Children...) {
+			if _, ok := recreated[name]; !ok {
+				all = false
+			}
+		}
+		if all {
+			suggestions = append(suggestions, s)
+		}
+	}
+	return suggestions
+}
+
+// Prints each suggestion as a comment block, separated from any commands
+// preceding it by a blank line
+func printSuggestions(w io.Writer, suggestions []zfs.Suggestion, afterCommands bool) {
+	for i, s := range suggestions {
+		if i != 0 || afterCommands {
+			fmt.Fprint(w, "\n")
+		}
+		fmt.Fprintf(w, "# suggestion: %s all set %s\n", strings.Join(s.Children, " "), strings.Join(s.Settings, " "))
+		fmt.Fprintf(w, "# which %s could set instead, for them to inherit:\n", s.Parent)
+		fmt.Fprintf(w, "#   zfs set %s %s\n", strings.Join(s.Settings, " "), s.Parent)
+	}
+}
+
+func printScript(w io.Writer, commands []zfs.Command, format textFormat) {
+	fmt.Fprintln(w, "#!/usr/bin/env bash")
+	fmt.Fprintf(w, "# Generated by zinfer %s on %s\n", version(), time.Now().Format(time.RFC3339))
+	fmt.Fprintln(w, "set -euo pipefail")
+	if len(commands) != 0 {
+		fmt.Fprint(w, "\n")
+	}
+	printText(w, commands, format)
+}
+
+// Writes data to a temporary file beside name, then renames it over name, so
+// that name is either left as it was or replaced in full. An existing file
+// keeps its permissions, otherwise perm is used.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	if fi, err := os.Stat(name); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(path.Dir(name), "."+path.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func version() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "(unknown)"
+}
+
+func printJSON(w io.Writer, commands []zfs.Command) error {
+	if commands == nil {
+		commands = []zfs.Command{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(commands)
+}
+
+var deviceNamings = map[string]zfs.DeviceNaming{
+	"":     zfs.DeviceAsReported,
+	"dev":  zfs.DeviceByDev,
+	"id":   zfs.DeviceById,
+	"path": zfs.DeviceByPath,
+	"vdev": zfs.DeviceByVdev,
+}
+
+// Collects the values of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Reports whether zfs accepts uri as a keylocation
+func validKeyLocation(uri string) bool {
+	switch {
+	case uri == "prompt":
+		return true
+	case strings.HasPrefix(uri, "file:///"):
+		return len(uri) > len("file:///")
+	case strings.HasPrefix(uri, "https://"):
+		return len(uri) > len("https://")
+	default:
+		return false
+	}
+}
+
+// Collects --keylocation uri and dataset=uri values, keying the former by ""
+type keyLocationFlag map[string]string
+
+func (f keyLocationFlag) String() string {
+	var values []string
+	for name, uri := range f {
+		values = append(values, name+"="+uri)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (f keyLocationFlag) Set(value string) error {
+	// URIs such as https://host/key?a=b may themselves contain =
+	name, uri := "", value
+	if i := strings.Index(value, "="); i > 0 && !strings.Contains(value[:i], "://") {
+		name, uri = value[:i], value[i+1:]
+	}
+	if uri == "" {
+		return fmt.Errorf("missing keylocation uri: %s", value)
+	}
+	if !validKeyLocation(uri) {
+		return fmt.Errorf("unsupported keylocation %s, expected prompt, file:///path, or https://url", uri)
+	}
+	f[name] = uri
+	return nil
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/josephvusich/zinfer/zfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out.sh")
+
+	// A new file takes perm
+	assert.NoError(writeFileAtomic(name, []byte("first version\n"), 0755))
+	b, err := os.ReadFile(name)
+	assert.NoError(err)
+	assert.Equal("first version\n", string(b))
+	fi, err := os.Stat(name)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0755), fi.Mode().Perm())
+
+	// An existing file keeps its mode, and is replaced whole by shorter data
+	assert.NoError(os.Chmod(name, 0600))
+	assert.NoError(writeFileAtomic(name, []byte("second\n"), 0644))
+	b, err = os.ReadFile(name)
+	assert.NoError(err)
+	assert.Equal("second\n", string(b))
+	fi, err = os.Stat(name)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+
+	// A failed rename leaves no temporary file behind
+	target := filepath.Join(dir, "subdir")
+	assert.NoError(os.Mkdir(target, 0755))
+	assert.Error(writeFileAtomic(target, []byte("lost\n"), 0644))
+	entries, err := os.ReadDir(dir)
+	assert.NoError(err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal([]string{"out.sh", "subdir"}, names)
+
+	assert.Error(writeFileAtomic(filepath.Join(dir, "missing", "out.sh"), nil, 0644))
+}
+
+func TestKeyLocationFlag(t *testing.T) {
+	assert := require.New(t)
+
+	for _, tc := range []struct {
+		value string
+		// Expected name and uri, or error if set
+		name, uri, err string
+	}{
+		{value: "prompt", uri: "prompt"},
+		{value: "file:///root/key", uri: "file:///root/key"},
+		{value: "https://keys.example.com/tank?id=1", uri: "https://keys.example.com/tank?id=1"},
+		{value: "tank/secure=file:///root/secure.key", name: "tank/secure", uri: "file:///root/secure.key"},
+		{value: "tank/secure=https://host/key?a=b", name: "tank/secure", uri: "https://host/key?a=b"},
+		{value: "tank/secure=prompt", name: "tank/secure", uri: "prompt"},
+		{value: "tank/secure=", err: "missing keylocation uri: tank/secure="},
+		{value: "", err: "missing keylocation uri: "},
+		{value: "/root/key", err: "unsupported keylocation /root/key, expected prompt, file:///path, or https://url"},
+		{value: "file://root/key", err: "unsupported keylocation file://root/key, expected prompt, file:///path, or https://url"},
+		{value: "file:///", err: "unsupported keylocation file:///, expected prompt, file:///path, or https://url"},
+		{value: "ftp://host/key", err: "unsupported keylocation ftp://host/key, expected prompt, file:///path, or https://url"},
+		{value: "tank=none", err: "unsupported keylocation none, expected prompt, file:///path, or https://url"},
+	} {
+		f := keyLocationFlag{}
+		err := f.Set(tc.value)
+		if tc.err != "" {
+			assert.EqualError(err, tc.err, tc.value)
+			assert.Empty(f)
+			continue
+		}
+		assert.NoError(err, tc.value)
+		assert.Equal(keyLocationFlag{tc.name: tc.uri}, f)
+	}
+
+	f := keyLocationFlag{}
+	assert.NoError(f.Set("file:///root/key"))
+	assert.NoError(f.Set("tank/b=prompt"))
+	assert.Equal("=file:///root/key,tank/b=prompt", f.String())
+}
+
+func TestSplitCapture(t *testing.T) {
+	assert := require.New(t)
+
+	zfsGet := "NAME  PROPERTY  VALUE       SOURCE\ntank  type      filesystem  -\n"
+	zpoolGet := "NAME  PROPERTY  VALUE  SOURCE\ntank  ashift    12     local\n"
+	status := "  pool: tank\n state: ONLINE\n"
+
+	read := func(in *zfs.Input) (zfsOut, zpoolOut string) {
+		r, err := in.ZfsGetAll()
+		assert.NoError(err)
+		b, err := io.ReadAll(r)
+		assert.NoError(err)
+		assert.NoError(r.Close())
+		zfsOut = string(b)
+		b, err = in.ZpoolGetAll()
+		assert.NoError(err)
+		return zfsOut, string(b)
+	}
+
+	in, err := splitCapture([]byte(zfsGet + "---\n" + zpoolGet))
+	assert.NoError(err)
+	zfsOut, zpoolOut := read(in)
+	assert.Equal(zfsGet, zfsOut)
+	assert.Equal(zpoolGet, zpoolOut)
+	assert.Nil(in.ZpoolStatus)
+
+	// Sentinels may be surrounded by whitespace, and the last line unterminated
+	in, err = splitCapture([]byte(zfsGet + "  ---  \n" + zpoolGet + "---\n" + strings.TrimSuffix(status, "\n")))
+	assert.NoError(err)
+	zfsOut, zpoolOut = read(in)
+	assert.Equal(zfsGet, zfsOut)
+	assert.Equal(zpoolGet, zpoolOut)
+	b, err := in.ZpoolStatus()
+	assert.NoError(err)
+	assert.Equal(strings.TrimSuffix(status, "\n"), string(b))
+
+	for _, tc := range []struct {
+		capture, err string
+	}{
+		{zfsGet, "expected 2 or 3 sections separated by --- lines, found 1"},
+		{zfsGet + "---\n" + zpoolGet + "---\n" + status + "---\n" + status, "expected 2 or 3 sections separated by --- lines, found 4"},
+		{"---\n" + zpoolGet, "zfs get all section is empty"},
+		{zfsGet + "---\n\n", "zpool get all section is empty"},
+		{zfsGet + "---\n---\n" + zpoolGet, "zpool get all section is empty"},
+		{zfsGet + "---\n" + zpoolGet + "---\n", "zpool status -P section is empty"},
+	} {
+		_, err := splitCapture([]byte(tc.capture))
+		assert.EqualError(err, tc.err, tc.capture)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+// Datasets selected by the dataset arguments, --recursive, --max-depth, and
+// --exclude
+type selection struct {
+	// Requested names and patterns that have not matched yet
+	requested map[string]struct{}
+	// Depth of each included dataset below the specified parent it descends from
+	depths     map[string]int
+	patterns   []string
+	exclusions []string
+	recursive  bool
+	// With recursive, the most levels included below a specified parent, or
+	// all of them if negative
+	maxDepth int
+	excluded map[string]struct{}
+}
+
+func newSelection(args, excludes []string, recursive bool, maxDepth int) (*selection, error) {
+	s := &selection{
+		requested:  map[string]struct{}{},
+		depths:     map[string]int{},
+		exclusions: excludes,
+		recursive:  recursive,
+		maxDepth:   maxDepth,
+		excluded:   map[string]struct{}{},
+	}
+	for _, name := range args {
+		s.requested[name] = struct{}{}
+		s.depths[name] = 0
+		if isGlob(name) {
+			if err := validateGlob(name); err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %s", name, err)
+			}
+			s.patterns = append(s.patterns, name)
+		}
+	}
+	for _, pattern := range excludes {
+		if err := validateGlob(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %s", pattern, err)
+		}
+	}
+	return s, nil
+}
+
+// Reports whether name is requested, which must be called for parents before
+// their children. Everything is requested if no names were specified.
+func (s *selection) selects(name string) bool {
+	if len(s.depths) == 0 {
+		return true
+	}
+	if _, ok := s.requested[name]; ok {
+		delete(s.requested, name)
+	} else if pattern := matchingGlob(s.patterns, name); pattern != "" {
+		delete(s.requested, pattern)
+		s.depths[name] = 0
+	} else if s.recursive {
+		depth, ok := s.depths[path.Dir(name)]
+		if !ok || (s.maxDepth >= 0 && depth >= s.maxDepth) {
+			return false
+		}
+		s.depths[name] = depth + 1
+	} else {
+		return false
+	}
+	return true
+}
+
+// Reports whether name matches --exclude or, with recursive, descends from a
+// dataset that did, which must be called for parents before their children
+func (s *selection) excludes(name string) bool {
+	if _, ok := s.excluded[path.Dir(name)]; (ok && s.recursive) || matchingGlob(s.exclusions, name) != "" {
+		s.excluded[name] = struct{}{}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectionMaxDepth(t *testing.T) {
+	assert := require.New(t)
+
+	names := []string{"tank", "tank/a", "tank/a/b", "tank/a/b/c", "tank/d"}
+	for _, tc := range []struct {
+		maxDepth int
+		selected []string
+	}{
+		{-1, []string{"tank/a", "tank/a/b", "tank/a/b/c"}},
+		{0, []string{"tank/a"}},
+		{1, []string{"tank/a", "tank/a/b"}},
+		{2, []string{"tank/a", "tank/a/b", "tank/a/b/c"}},
+	} {
+		sel, err := newSelection([]string{"tank/a"}, nil, true, tc.maxDepth)
+		assert.NoError(err)
+		var selected []string
+		for _, name := range names {
+			if sel.selects(name) {
+				selected = append(selected, name)
+			}
+		}
+		assert.Equal(tc.selected, selected, "--max-depth %d", tc.maxDepth)
+		assert.Empty(sel.requested)
+	}
+}
+
+func TestSelectionExcludes(t *testing.T) {
+	assert := require.New(t)
+
+	sel, err := newSelection([]string{"tank/*", "tank/gone"}, []string{"tank/a/b"}, true, -1)
+	assert.NoError(err)
+	var selected []string
+	for _, name := range []string{"tank", "tank/a", "tank/a/b", "tank/a/b/c", "tank/d"} {
+		if sel.selects(name) && !sel.excludes(name) {
+			selected = append(selected, name)
+		}
+	}
+	assert.Equal([]string{"tank/a", "tank/d"}, selected)
+	assert.Equal(map[string]struct{}{"tank/gone": {}}, sel.requested)
+
+	_, err = newSelection([]string{"tank/["}, nil, false, -1)
+	assert.EqualError(err, "invalid pattern tank/[: syntax error in pattern")
+}
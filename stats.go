@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/josephvusich/go-getopt"
+	"github.com/josephvusich/zinfer/zfs"
+)
+
+// Prints an overview of each pool, live or from a capture in the --stdin
+// format, without generating any commands
+func statsMain(args []string) {
+	flags := getopt.NewFlagSet("stats", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "print the stats as a JSON array")
+	if err := flags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if flags.NArg() > 1 {
+		log.Fatal("usage: zinfer stats [--json] [capture-file]")
+	}
+
+	var pools map[string]*zfs.Pool
+	var err error
+	if flags.NArg() == 1 {
+		b, err := os.ReadFile(flags.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			log.Fatalf("%s is empty", flags.Arg(0))
+		}
+		input, err := splitCapture(b)
+		if err != nil {
+			log.Fatalf("%s: %s", flags.Arg(0), err)
+		}
+		input.Unordered = true
+		if pools, err = zfs.ImportedPoolsFrom(input); err != nil {
+			log.Fatalf("captured input: %s", err)
+		}
+	} else if pools, err = zfs.ImportedPools(); err != nil {
+		log.Fatal(err)
+	}
+
+	stats := make([]zfs.Stats, 0, len(pools))
+	for _, p := range pools {
+		stats = append(stats, p.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Pool < stats[j].Pool })
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POOL\tDATASETS\tLOCAL PROPERTIES\tENCRYPTION ROOTS\tINACTIVE FEATURES")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", s.Pool, s.Datasets, s.LocalProperties, s.EncryptionRoots, s.InactiveFeatures)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
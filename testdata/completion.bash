@@ -0,0 +1,26 @@
+_zinfer() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+	case $prev in
+	--keylocation|--max-depth|--only-property|--pool|--prefix|--skip-property|--where)
+		COMPREPLY=()
+		return;;
+	--exclude)
+		COMPREPLY=($(compgen -W "$(zfs list -H -o name 2>/dev/null)" -- "$cur"))
+		return;;
+	--device-naming)
+		COMPREPLY=($(compgen -W "dev id path vdev" -- "$cur"))
+		return;;
+	--output|--template|--zfs-get-file|--zpool-get-file|--zpool-status-file)
+		COMPREPLY=($(compgen -f -- "$cur"))
+		return;;
+	--quote)
+		COMPREPLY=($(compgen -W "fish none sh" -- "$cur"))
+		return;;
+	esac
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "--altroot --annotate --annotate-properties --bookmarks --confirm-destroy --continue-on-error --create-parents --destroy --device-naming --diff-against-defaults --dry-run --exclude --execute --explicit-inherit --help --holds --import --json --json-input --keylocation --load-key --max-depth --minimal-features --mkdir --no-mount --no-received --no-shares --no-user-properties --oneline --only-local --only-property --output -w --parseable --partial-input --permissions --pool --prefix --preserve-active --quote --recursive -R --script --skip-property --snapshots --stdin --sudo --suggest-inheritance --template --validate --verbose --where --yes --zfs-get-file --zpool-get-file --zpool-status-file" -- "$cur"))
+	else
+		COMPREPLY=($(compgen -W "$(zfs list -H -o name 2>/dev/null)" -- "$cur"))
+	fi
+}
+complete -F _zinfer zinfer
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/josephvusich/zinfer/zfs"
+)
+
+// A --where condition on the effective value of a property
+type whereFilter struct {
+	property string
+	value    string
+	negate   bool
+	// Whether any dataset has matched
+	matched bool
+}
+
+func (f *whereFilter) String() string {
+	op := "="
+	if f.negate {
+		op = "!="
+	}
+	return f.property + op + f.value
+}
+
+// Reports whether the value of the property on d matches, where a value
+// ending in * matches by prefix. A missing property has the value "".
+func (f *whereFilter) matches(d *zfs.Dataset) bool {
+	var value string
+	if prop, ok := d.Properties[f.property]; ok {
+		value = prop.Value()
+	}
+
+	var equal bool
+	if prefix := strings.TrimSuffix(f.value, "*"); prefix != f.value {
+		equal = strings.HasPrefix(value, prefix)
+	} else {
+		equal = value == f.value
+	}
+	return equal != f.negate
+}
+
+// Conditions that must all hold, see --where
+type whereFlag []*whereFilter
+
+func (w *whereFlag) String() string {
+	var conds []string
+	for _, f := range *w {
+		conds = append(conds, f.String())
+	}
+	return strings.Join(conds, ",")
+}
+
+func (w *whereFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected property=value or property!=value: %s", value)
+	}
+	f := &whereFilter{property: value[:i], value: value[i+1:]}
+	if strings.HasSuffix(f.property, "!") {
+		f.property, f.negate = strings.TrimSuffix(f.property, "!"), true
+	}
+	if f.property == "" {
+		return fmt.Errorf("missing property: %s", value)
+	}
+	*w = append(*w, f)
+	return nil
+}
+
+// Reports whether d matches every condition, noting which conditions matched
+func (w whereFlag) matches(d *zfs.Dataset) bool {
+	all := true
+	for _, f := range w {
+		if f.matches(d) {
+			f.matched = true
+		} else {
+			all = false
+		}
+	}
+	return all
+}
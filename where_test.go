@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/josephvusich/zinfer/zfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhereFlagSet(t *testing.T) {
+	assert := require.New(t)
+
+	for _, tc := range []struct {
+		value string
+		// Expected String, or error if set
+		expected, err string
+	}{
+		{value: "compression=zstd", expected: "compression=zstd"},
+		{value: "compression!=off", expected: "compression!=off"},
+		{value: "org:note=", expected: "org:note="},
+		{value: "mountpoint=/srv*", expected: "mountpoint=/srv*"},
+		{value: "compression", err: "expected property=value or property!=value: compression"},
+		{value: "=zstd", err: "expected property=value or property!=value: =zstd"},
+		{value: "!=zstd", err: "missing property: !=zstd"},
+	} {
+		var w whereFlag
+		err := w.Set(tc.value)
+		if tc.err != "" {
+			assert.EqualError(err, tc.err, tc.value)
+			assert.Empty(w)
+			continue
+		}
+		assert.NoError(err, tc.value)
+		assert.Equal(tc.expected, w.String())
+	}
+}
+
+func TestWhereFlagMatches(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := zfs.ParseProperties([]byte(`NAME        PROPERTY     VALUE       SOURCE
+tank        type         filesystem  -
+tank        compression  lz4         local
+tank/srv    type         filesystem  -
+tank/srv    compression  zstd        local
+tank/srv    mountpoint   /srv/www    local
+tank/other  type         filesystem  -
+tank/other  compression  lz4         inherited from tank`), []byte(`NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    0      default`))
+	assert.NoError(err)
+	datasets := pools["tank"].Datasets.Index
+
+	for _, tc := range []struct {
+		conds   []string
+		matches []string
+	}{
+		{[]string{"compression=zstd"}, []string{"tank/srv"}},
+		{[]string{"compression!=zstd"}, []string{"tank", "tank/other"}},
+		{[]string{"compression=lz4"}, []string{"tank", "tank/other"}},
+		{[]string{"mountpoint=/srv*"}, []string{"tank/srv"}},
+		{[]string{"org:note="}, []string{"tank", "tank/other", "tank/srv"}},
+		{[]string{"org:note!="}, nil},
+		{[]string{"compression=lz4", "mountpoint=/srv*"}, nil},
+		{[]string{"compression!=off", "mountpoint=/srv/www"}, []string{"tank/srv"}},
+	} {
+		var w whereFlag
+		for _, c := range tc.conds {
+			assert.NoError(w.Set(c))
+		}
+		var matches []string
+		for _, name := range []string{"tank", "tank/other", "tank/srv"} {
+			if w.matches(datasets[name]) {
+				matches = append(matches, name)
+			}
+		}
+		assert.Equal(tc.matches, matches, "%s", w.String())
+	}
+
+	// Conditions are noted as matched even where another one fails
+	var w whereFlag
+	assert.NoError(w.Set("compression=zstd"))
+	assert.NoError(w.Set("org:note=x"))
+	assert.False(w.matches(datasets["tank/srv"]))
+	assert.True(w[0].matched)
+	assert.False(w[1].matched)
+}
@@ -0,0 +1,44 @@
+package zfs
+
+import "fmt"
+
+type Bookmark struct {
+	// Full name, e.g. tank/home#keep
+	Name       string
+	Properties map[string]*Property
+	// Snapshot the bookmark was created from, or nil if it no longer exists
+	Source *Snapshot
+}
+
+// A bookmark shares the guid and createtxg of the snapshot it was created from
+func (b *Bookmark) findSource(set *Dataset) *Snapshot {
+	for _, id := range []string{"guid", "createtxg"} {
+		prop, ok := b.Properties[id]
+		if !ok {
+			continue
+		}
+		for _, s := range set.Snapshots {
+			if sp, ok := s.Properties[id]; ok && sp.Value() == prop.Value() {
+				return s
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+func (p *Pool) CreateBookmarkCommand(name string) (cmdline []string, err error) {
+	set, ok := p.Datasets.Index[snapshotDataset(name)]
+	if ok {
+		for _, b := range set.Bookmarks {
+			if b.Name != name {
+				continue
+			}
+			if b.Source == nil {
+				return nil, fmt.Errorf("source snapshot of bookmark %s no longer exists", name)
+			}
+			return []string{"zfs", "bookmark", b.Source.Name, b.Name}, nil
+		}
+	}
+	return nil, fmt.Errorf("bookmark %s not found in pool %s", name, p.Name)
+}
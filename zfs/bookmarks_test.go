@@ -0,0 +1,43 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBookmarks(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME            PROPERTY   VALUE       SOURCE
+tank            type       filesystem  -
+tank/home       type       filesystem  -
+tank/home@snap  type       snapshot    -
+tank/home@snap  guid       1111        -
+tank/home@snap  createtxg  10          -
+tank/home#keep  type       bookmark    -
+tank/home#keep  guid       1111        -
+tank/home#keep  createtxg  10          -
+tank/home#gone  type       bookmark    -
+tank/home#gone  guid       2222        -
+tank/home#gone  createtxg  5           -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	pool := pools["tank"]
+	set := pool.Datasets.Index["tank/home"]
+	assert.Len(set.Bookmarks, 2)
+	assert.Equal(set.Snapshots[0], set.Bookmarks[0].Source)
+	assert.Nil(set.Bookmarks[1].Source)
+
+	cmdline, err := pool.CreateBookmarkCommand("tank/home#keep")
+	assert.NoError(err)
+	assert.Equal([]string{"zfs", "bookmark", "tank/home@snap", "tank/home#keep"}, cmdline)
+
+	_, err = pool.CreateBookmarkCommand("tank/home#gone")
+	assert.EqualError(err, "source snapshot of bookmark tank/home#gone no longer exists")
+
+	_, err = pool.CreateBookmarkCommand("tank/home#missing")
+	assert.EqualError(err, "bookmark tank/home#missing not found in pool tank")
+}
@@ -0,0 +1,100 @@
+package zfs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Returns the origin snapshot of a cloned dataset, or "" if it is not a clone
+func (d *Dataset) origin() string {
+	if prop, ok := d.Properties["origin"]; ok && prop.Value() != "-" && prop.Value() != "" {
+		return prop.Value()
+	}
+	return ""
+}
+
+// Datasets that must be created before d: its parent and the dataset owning
+// its origin, unless the origin is promoted, see promotedOrigin
+func (p *Pool) dependencies(d *Dataset) (deps []*Dataset) {
+	if !isRootDataset(d.Name) {
+		if parent, ok := p.Datasets.Index[path.Dir(d.Name)]; ok {
+			deps = append(deps, parent)
+		}
+	}
+	if set := p.originDataset(d); set != nil && !p.promotedOrigin(d) {
+		deps = append(deps, set)
+	}
+	return deps
+}
+
+// Returns the dataset owning the origin of d, or nil if there is none
+func (p *Pool) originDataset(d *Dataset) *Dataset {
+	if origin := d.origin(); origin != "" {
+		return p.Datasets.Index[snapshotDataset(origin)]
+	}
+	return nil
+}
+
+// Reports whether the dataset owning the origin of d must itself be created
+// after d, following parents and origins. zfs promote of a descendant leaves
+// its parent cloned from one of its snapshots, which zfs clone can't reproduce.
+func (p *Pool) promotedOrigin(d *Dataset) bool {
+	seen := map[*Dataset]bool{}
+	var reaches func(set *Dataset) bool
+	reaches = func(set *Dataset) bool {
+		if set == nil || seen[set] {
+			return false
+		}
+		if set == d {
+			return true
+		}
+		seen[set] = true
+		return reaches(p.Datasets.Index[path.Dir(set.Name)]) || reaches(p.originDataset(set))
+	}
+	return reaches(p.originDataset(d))
+}
+
+// OrderedDatasets returns the datasets of p ordered so that every dataset
+// follows its parent and the dataset containing its origin snapshot.
+// Otherwise the order of Datasets.Ordered is preserved.
+func (p *Pool) OrderedDatasets() ([]*Dataset, error) {
+	ordered := make([]*Dataset, 0, len(p.Datasets.Ordered))
+	done := make(map[*Dataset]bool)
+	var visiting []*Dataset
+
+	var visit func(d *Dataset) error
+	visit = func(d *Dataset) error {
+		if done[d] {
+			return nil
+		}
+		for i, v := range visiting {
+			if v == d {
+				var names []string
+				for _, c := range append(visiting[i:], d) {
+					names = append(names, c.Name)
+				}
+				return fmt.Errorf("dependency cycle: %s", strings.Join(names, " -> "))
+			}
+		}
+
+		visiting = append(visiting, d)
+		for _, dep := range p.dependencies(d) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		visiting = visiting[:len(visiting)-1]
+
+		done[d] = true
+		ordered = append(ordered, d)
+		return nil
+	}
+
+	for _, d := range p.Datasets.Ordered {
+		if err := visit(d); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,199 @@
+package zfs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderedDatasets(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME          PROPERTY  VALUE       SOURCE
+tank          type      filesystem  -
+tank          origin    -           -
+tank/clone    type      filesystem  -
+tank/clone    origin    tank/base@s -
+tank/clone/x  type      filesystem  -
+tank/clone/x  origin    -           -
+tank/base     type      filesystem  -
+tank/base     origin    -           -
+tank/base@s   type      snapshot    -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	ordered, err := pools["tank"].OrderedDatasets()
+	assert.NoError(err)
+
+	var names []string
+	for _, d := range ordered {
+		names = append(names, d.Name)
+	}
+	assert.Equal([]string{"tank", "tank/base", "tank/clone", "tank/clone/x"}, names)
+
+	// zfs promote of tank/clone/src would leave this, with no cycle to break
+	promoted := []byte(`NAME              PROPERTY  VALUE             SOURCE
+tank              type      filesystem        -
+tank/clone        type      filesystem        -
+tank/clone        origin    tank/clone/src@s  -
+tank/clone/src    type      filesystem        -
+tank/clone/src@s  type      snapshot          -`)
+
+	pools, err = parseGetAll(promoted, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	ordered, err = pools["tank"].OrderedDatasets()
+	assert.NoError(err)
+	names = nil
+	for _, d := range ordered {
+		names = append(names, d.Name)
+	}
+	assert.Equal([]string{"tank", "tank/clone", "tank/clone/src"}, names)
+}
+
+func TestPromotedClone(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	// tank/old was promoted over by its clone tank/new, and tank/vm by its
+	// clone tank/vm/work, taking the snapshots that preceded the clone
+	input := []byte(`NAME              PROPERTY  VALUE             SOURCE
+tank              type      filesystem        -
+tank/old          type      filesystem        -
+tank/old          origin    tank/new@s        -
+tank/new          type      filesystem        -
+tank/new          atime     off               local
+tank/new@s        type      snapshot          -
+tank/new@s        createtxg 10                -
+tank/vm           type      filesystem        -
+tank/vm           origin    tank/vm/work@s    -
+tank/vm/work      type      filesystem        -
+tank/vm/work@s    type      snapshot          -
+tank/vm/work@s    createtxg 20                -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+
+	opts := NewFlagOptions(WithClones(true), WithSnapshots(true))
+	commands, err := pool.AllCommands(opts)
+	assert.NoError(err)
+	var actual []string
+	for _, c := range commands {
+		actual = append(actual, c.Oneline())
+	}
+	assert.Equal([]string{
+		"zpool create -d tank",
+		"zfs create -o atime=off tank/new",
+		"zfs snapshot tank/new@s",
+		"zfs clone tank/new@s tank/old",
+		"zfs create tank/vm",
+		"zfs create tank/vm/work",
+		"zfs snapshot tank/vm/work@s",
+	}, actual)
+	assert.Equal([]string{
+		"origin tank/vm/work@s of tank/vm belongs to a dataset that must be created after it, as left by zfs promote; the clone will be created as a new dataset",
+	}, warnings)
+}
+
+func TestCreateCloneCommand(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME          PROPERTY  VALUE        SOURCE
+tank          type      filesystem   -
+tank/base     type      filesystem   -
+tank/base@s   type      snapshot     -
+tank/clone    type      filesystem   -
+tank/clone    origin    tank/base@s  -
+tank/clone    atime     off          local
+tank/orphan   type      filesystem   -
+tank/orphan   origin    tank/gone@s  -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+
+	cmdline, err := pool.CreateDatasetCommand("tank/clone", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o atime=off tank/clone", strings.Join(cmdline, " "))
+
+	cmdline, err = pool.CreateDatasetCommand("tank/clone", &FlagOptions{Clones: true})
+	assert.NoError(err)
+	assert.Equal("zfs clone -o atime=off tank/base@s tank/clone", strings.Join(cmdline, " "))
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	cmdline, err = pool.CreateDatasetCommand("tank/orphan", &FlagOptions{Clones: true})
+	assert.NoError(err)
+	assert.Equal("zfs create tank/orphan", strings.Join(cmdline, " "))
+	assert.Equal([]string{"origin tank/gone@s of tank/orphan not found, the clone will be created as a new dataset"}, warnings)
+}
+
+func TestClonedEncryptionRoot(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	input := []byte(`NAME          PROPERTY        VALUE        SOURCE
+tank          type            filesystem   -
+tank/enc      type            filesystem   -
+tank/enc      encryptionroot  tank/enc     -
+tank/enc      encryption      aes-256-gcm  -
+tank/enc      keyformat       passphrase   -
+tank/enc      keylocation     prompt       local
+tank/enc      pbkdf2iters     350000       -
+tank/enc      keystatus       available    -
+tank/enc@s    type            snapshot     -
+tank/clone    type            filesystem   -
+tank/clone    origin          tank/enc@s   -
+tank/clone    encryptionroot  tank/enc     -
+tank/clone    encryption      aes-256-gcm  -
+tank/clone    keyformat       passphrase   -
+tank/clone    keylocation     none         default
+tank/clone    pbkdf2iters     350000       -
+tank/clone    keystatus       available    -
+tank/other    type            filesystem   -
+tank/other    origin          gone/enc@s   -
+tank/other    encryptionroot  gone/enc     -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+	assert.Equal("tank/enc", pool.Datasets.Index["tank/clone"].ExternalEncryptionRoot)
+	assert.Equal("gone/enc", pool.Datasets.Index["tank/other"].ExternalEncryptionRoot)
+	assert.Equal("", pool.Datasets.Index["tank/enc"].ExternalEncryptionRoot)
+
+	// zfs clone inherits the encryption of its origin
+	cmdline, err := pool.CreateDatasetCommand("tank/clone", &FlagOptions{Clones: true})
+	assert.NoError(err)
+	assert.Equal("zfs clone tank/enc@s tank/clone", strings.Join(cmdline, " "))
+	assert.Empty(warnings)
+
+	cmdline, err = pool.CreateDatasetCommand("tank/clone", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create tank/clone", strings.Join(cmdline, " "))
+	assert.Equal([]string{"encryptionroot tank/enc of tank/clone is not an ancestor, zfs create can't reproduce its encryption"}, warnings)
+
+	// Without an origin, a missing encryption root is still an error
+	_, err = parseGetAll([]byte(`NAME      PROPERTY        VALUE       SOURCE
+tank      type            filesystem  -
+tank/a    type            filesystem  -
+tank/a    encryptionroot  gone/enc    -`), map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "tank/a encryptionroot gone/enc not found")
+}
@@ -0,0 +1,402 @@
+package zfs
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/alessio/shellescape.v1"
+)
+
+// CommandKind is what a Command recreates or acts on
+type CommandKind string
+
+const (
+	CommandPool      CommandKind = "pool"
+	CommandDataset   CommandKind = "dataset"
+	CommandSet       CommandKind = "set"
+	CommandChangeKey CommandKind = "change-key"
+	CommandLoadKey   CommandKind = "load-key"
+	CommandInherit   CommandKind = "inherit"
+	CommandBootfs    CommandKind = "bootfs"
+	CommandAllow     CommandKind = "allow"
+	CommandSnapshot  CommandKind = "snapshot"
+	CommandHold      CommandKind = "hold"
+	CommandBookmark  CommandKind = "bookmark"
+	CommandImport    CommandKind = "import"
+	CommandDestroy   CommandKind = "destroy"
+)
+
+// Command is a zpool or zfs command line along with what it acts on
+type Command struct {
+	Kind CommandKind `json:"type"`
+	// The pool, dataset, snapshot, or bookmark the command acts on
+	Target string   `json:"name"`
+	Argv   []string `json:"argv"`
+	// Notes on the command for the reader, without the leading #
+	Comment string `json:"comment,omitempty"`
+	// Notes on arguments by index, such as the source of a property, shown
+	// only in multiline Format
+	Notes map[int]string `json:"-"`
+
+	// Argument to break the line before in String, if not Target
+	wrapAt string
+}
+
+// Quoter escapes a command argument for a shell
+type Quoter interface {
+	Quote(arg string) string
+}
+
+// QuoteFunc is a function implementing Quoter
+type QuoteFunc func(arg string) string
+
+func (f QuoteFunc) Quote(arg string) string {
+	return f(arg)
+}
+
+var (
+	// Quotes for POSIX shells such as sh and bash
+	QuoteSh Quoter = QuoteFunc(shellescape.Quote)
+	// Quotes for fish, where only \\ and \' are escapes within single quotes
+	QuoteFish Quoter = QuoteFunc(fishQuote)
+	// Leaves arguments as they are, for consumers that split on spaces
+	QuoteNone Quoter = QuoteFunc(func(arg string) string { return arg })
+)
+
+// Characters that need no quoting in either sh or fish
+var unsafeChars = regexp.MustCompile(`[^\w@%+=:,./-]`)
+
+func fishQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	if !unsafeChars.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(arg) + "'"
+}
+
+// Returns the shell-escaped command, broken over lines before each -o or -O
+// and before the target, which may be followed by vdevs
+func (c Command) String() string {
+	return c.Format(QuoteSh, true)
+}
+
+// Oneline returns the shell-escaped command on a single line
+func (c Command) Oneline() string {
+	return c.Format(QuoteSh, false)
+}
+
+// Format returns the command with each argument quoted by q, and if
+// multiline, broken over lines as by String with its Notes after the
+// arguments they describe. Notes are only valid in sh.
+func (c Command) Format(q Quoter, multiline bool) string {
+	wrapAt := c.Target
+	if c.wrapAt != "" {
+		wrapAt = c.wrapAt
+	}
+
+	quoted := make([]string, len(c.Argv))
+	seenTarget := false
+	for i, arg := range c.Argv {
+		isTarget := !seenTarget && arg == wrapAt
+		seenTarget = seenTarget || isTarget
+		quoted[i] = q.Quote(arg)
+		if multiline && (arg == "-o" || arg == "-O" || isTarget) {
+			quoted[i] = "\\\n  " + quoted[i]
+		}
+		// A comment can't precede a line continuation, but an empty command
+		// substitution holding one can
+		if note, ok := c.Notes[i]; ok && multiline {
+			quoted[i] += " `# " + note + "`"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// WithPrefix returns the command preceded by words, such as sudo, keeping its
+// Notes on the arguments they describe
+func (c Command) WithPrefix(words ...string) Command {
+	c.Argv = append(append([]string(nil), words...), c.Argv...)
+	if c.Notes != nil {
+		notes := make(map[int]string, len(c.Notes))
+		for i, note := range c.Notes {
+			notes[i+len(words)] = note
+		}
+		c.Notes = notes
+	}
+	return c
+}
+
+// PoolCommand is CreatePoolCommand as a Command, commented with its active
+// features if opts.PreserveActive is set
+func (p *Pool) PoolCommand(opts *FlagOptions) (Command, error) {
+	if opts == nil {
+		opts = defaultFlagOpts
+	}
+	argv, err := p.CreatePoolCommand(opts)
+	if err != nil {
+		return Command{}, err
+	}
+	c := Command{Kind: CommandPool, Target: p.Name, Argv: argv}
+	if active := p.ActiveFeatures(opts); opts.PreserveActive && len(active) != 0 {
+		c.Comment = "active: " + strings.Join(active, " ")
+	}
+	if opts.AnnotateProperties {
+		c.Notes = propertyNotes(argv, map[string]map[string]*Property{
+			"-o": p.Properties,
+			"-O": p.Datasets.Index[p.Name].Properties,
+		})
+	}
+	return c, nil
+}
+
+// DatasetCommand is CreateDatasetCommand as a Command. The lines of a zfs
+// clone break before the origin, which precedes the target. With
+// opts.AnnotateProperties, its Notes give the source of each property.
+func (p *Pool) DatasetCommand(name string, opts *FlagOptions) (Command, error) {
+	argv, err := p.CreateDatasetCommand(name, opts)
+	if err != nil {
+		return Command{}, err
+	}
+	c := Command{Kind: CommandDataset, Target: name, Argv: argv}
+	if argv[1] == "clone" {
+		c.wrapAt = c.Origin()
+	}
+	if opts != nil && opts.AnnotateProperties {
+		c.Notes = propertyNotes(argv, map[string]map[string]*Property{
+			"-o": p.Datasets.Index[name].Properties,
+		})
+	}
+	return c, nil
+}
+
+// Returns the source of the property set by each name=value argument
+// following a flag in props, keyed by argument index. Features requested as
+// enabled are noted if they were active.
+func propertyNotes(argv []string, props map[string]map[string]*Property) map[int]string {
+	notes := map[int]string{}
+	for i := 1; i < len(argv); i++ {
+		byName, ok := props[argv[i-1]]
+		if !ok {
+			continue
+		}
+		prop, ok := byName[strings.SplitN(argv[i], "=", 2)[0]]
+		if !ok {
+			continue
+		}
+		if prop.isFeature() && prop.localValue == FeatureActive {
+			notes[i] = "was active"
+		} else {
+			notes[i] = prop.Source.String()
+		}
+	}
+	return notes
+}
+
+// ImportCommands returns the zpool import of the pool, for use after it is
+// exported, followed with opts.LoadKeys by the zfs load-key of each encryption
+// root among names, whose keys the export unloaded
+func (p *Pool) ImportCommands(names []string, opts *FlagOptions) (commands []Command, err error) {
+	if opts == nil {
+		opts = defaultFlagOpts
+	}
+	commands = append(commands, Command{Kind: CommandImport, Target: p.Name, Argv: p.ImportPoolCommand(opts)})
+	if !opts.LoadKeys {
+		return commands, nil
+	}
+	for _, name := range names {
+		if d, ok := p.Datasets.Index[name]; !ok || !d.IsEncryptionRoot() {
+			continue
+		}
+		cmd, err := p.LoadKeyCommand(name)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, Command{Kind: CommandLoadKey, Target: name, Argv: cmd})
+	}
+	return commands, nil
+}
+
+// Returns the origin snapshot of a zfs clone command, or "" for other commands
+func (c Command) Origin() string {
+	if c.Kind != CommandDataset || len(c.Argv) < 4 || c.Argv[1] != "clone" {
+		return ""
+	}
+	return c.Argv[len(c.Argv)-2]
+}
+
+// SnapshotCommand is CreateSnapshotCommand as a Command
+func (p *Pool) SnapshotCommand(name string) (Command, error) {
+	argv, err := p.CreateSnapshotCommand(name)
+	if err != nil {
+		return Command{}, err
+	}
+	return Command{Kind: CommandSnapshot, Target: name, Argv: argv}, nil
+}
+
+// Returns each command line as a Command of kind acting on target
+func commandsOf(kind CommandKind, target string, argvs [][]string) []Command {
+	commands := make([]Command, len(argvs))
+	for i, argv := range argvs {
+		commands[i] = Command{Kind: kind, Target: target, Argv: argv}
+	}
+	return commands
+}
+
+// CommandsFor returns the commands recreating the pool or dataset name: its
+// zpool create and zpool set or zfs create, its zfs change-key if any, then as enabled by
+// opts its zfs inherit, bootfs, zfs allow, and the snapshots, holds, and
+// bookmarks of the dataset. Keys are left loaded by zfs create, so zfs
+// load-key only follows ImportCommands.
+func (p *Pool) CommandsFor(name string, opts *FlagOptions) (commands []Command, err error) {
+	if opts == nil {
+		opts = defaultFlagOpts
+	}
+
+	var c Command
+	if name == p.Name {
+		c, err = p.PoolCommand(opts)
+	} else {
+		c, err = p.DatasetCommand(name, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	commands = append(commands, c)
+
+	if name == p.Name {
+		commands = append(commands, commandsOf(CommandSet, name, p.SetPropertyCommands(opts))...)
+	} else {
+		cmd, err := p.ChangeKeyCommand(name)
+		if err != nil {
+			return nil, err
+		}
+		if cmd != nil {
+			commands = append(commands, Command{Kind: CommandChangeKey, Target: name, Argv: cmd})
+		}
+	}
+
+	if opts.ExplicitInherit {
+		inherit, err := p.CreateInheritCommands(name)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, commandsOf(CommandInherit, name, inherit)...)
+	}
+
+	if name != p.Name && name == p.Bootfs() {
+		cmd, err := p.SetBootfsCommand()
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, Command{Kind: CommandBootfs, Target: p.Name, Argv: cmd})
+	}
+
+	allow, err := p.CreateAllowCommands(name)
+	if err != nil {
+		return nil, err
+	}
+	commands = append(commands, commandsOf(CommandAllow, name, allow)...)
+
+	if !opts.Snapshots {
+		return commands, nil
+	}
+
+	set := p.Datasets.Index[name]
+	for _, snap := range set.Snapshots {
+		c, err := p.SnapshotCommand(snap.Name)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, c)
+
+		if !opts.Holds {
+			continue
+		}
+		for _, tag := range snap.Holds {
+			cmd, err := p.CreateHoldCommand(snap.Name, tag)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, Command{Kind: CommandHold, Target: snap.Name, Argv: cmd})
+		}
+	}
+
+	if opts.Bookmarks {
+		for _, b := range set.Bookmarks {
+			if b.Source == nil {
+				Warnf("skipping bookmark %s, its source snapshot no longer exists", b.Name)
+				continue
+			}
+			cmd, err := p.CreateBookmarkCommand(b.Name)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, Command{Kind: CommandBookmark, Target: b.Name, Argv: cmd})
+		}
+	}
+
+	return commands, nil
+}
+
+// AllCommands returns the commands recreating the pool and all of its
+// datasets, in the order they must be run. Datasets are created parents
+// first, and with opts.Clones after the dataset holding their origin.
+// With opts.CreateParents, datasets implied by zfs create -p are left out.
+func (p *Pool) AllCommands(opts *FlagOptions) (commands []Command, err error) {
+	if opts == nil {
+		opts = defaultFlagOpts
+	}
+
+	datasets := p.Datasets.Ordered
+	if opts.Clones {
+		if datasets, err = p.OrderedDatasets(); err != nil {
+			return nil, err
+		}
+	}
+
+	if commands, err = p.CommandsFor(p.Name, opts); err != nil {
+		return nil, err
+	}
+	for _, d := range datasets {
+		if d.Name == p.Name {
+			continue
+		}
+		c, err := p.CommandsFor(d.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, c...)
+	}
+	return p.DropImplied(commands, opts), nil
+}
+
+// DropImplied drops the zfs create and zfs inherit commands of datasets that
+// zfs create -p of a descendant in commands creates identically, see Implied
+func (p *Pool) DropImplied(commands []Command, opts *FlagOptions) []Command {
+	covered := map[string]bool{}
+	for _, c := range commands {
+		if c.Kind != CommandDataset {
+			continue
+		}
+		for dir := path.Dir(c.Target); dir != "."; dir = path.Dir(dir) {
+			if _, ok := p.Datasets.Index[dir]; ok && !covered[dir] && p.Implied(dir, opts) {
+				covered[dir] = true
+			}
+		}
+	}
+
+	kept := commands[:0]
+	for _, c := range commands {
+		if covered[c.Target] && (c.Kind == CommandDataset || c.Kind == CommandInherit) {
+			if c.Kind == CommandDataset {
+				Omitf("%s: omitting, created by zfs create -p of a descendant", c.Target)
+			}
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
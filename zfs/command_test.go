@@ -0,0 +1,174 @@
+package zfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME           PROPERTY  VALUE        SOURCE
+tank           type      filesystem   -
+tank/base      type      filesystem   -
+tank/base@s    type      snapshot     -
+tank/clone     type      filesystem   -
+tank/clone     origin    tank/base@s  -
+tank/clone     atime     off          local`), []byte(`NAME  PROPERTY  VALUE         SOURCE
+tank  comment   backup  pool  local`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	c, err := pool.PoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal(CommandPool, c.Kind)
+	assert.Equal("tank", c.Target)
+	assert.Equal("zpool create -d \\\n  tank", c.String())
+	assert.Equal("zpool create -d tank", c.Oneline())
+
+	commands, err := pool.CommandsFor("tank", nil)
+	assert.NoError(err)
+	assert.Len(commands, 2)
+	assert.Equal(CommandSet, commands[1].Kind)
+	assert.Equal("zpool set 'comment=backup  pool' tank", commands[1].Oneline())
+
+	c, err = pool.DatasetCommand("tank/clone", &FlagOptions{Clones: true})
+	assert.NoError(err)
+	assert.Equal(CommandDataset, c.Kind)
+	assert.Equal("tank/base@s", c.Origin())
+	assert.Equal("zfs clone \\\n  -o atime=off \\\n  tank/base@s tank/clone", c.String())
+	assert.Equal("zfs clone -o atime=off tank/base@s tank/clone", c.Oneline())
+
+	c, err = pool.DatasetCommand("tank/clone", nil)
+	assert.NoError(err)
+	assert.Equal("", c.Origin())
+	assert.Equal("zfs create \\\n  -o atime=off \\\n  tank/clone", c.String())
+
+	c, err = pool.SnapshotCommand("tank/base@s")
+	assert.NoError(err)
+	assert.Equal(Command{Kind: CommandSnapshot, Target: "tank/base@s", Argv: []string{"zfs", "snapshot", "tank/base@s"}}, c)
+}
+
+func TestAllCommands(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME          PROPERTY     VALUE        SOURCE
+tank          type         filesystem   -
+tank          compression  lz4          local
+tank/a        type         filesystem   -
+tank/a        compression  lz4          inherited from tank
+tank/a/b      type         filesystem   -
+tank/a/b      atime        off          local
+tank/a/b@s    type         snapshot     -
+tank/a/b@s    createtxg    10           -
+tank/clone    type         filesystem   -
+tank/clone    origin       tank/a/b@s   -
+tank/clone    atime        off          inherited from tank/a/b`), []byte(`NAME  PROPERTY  VALUE      SOURCE
+tank  bootfs    tank/a/b   local`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	summarize := func(commands []Command) (lines []string) {
+		for _, c := range commands {
+			lines = append(lines, string(c.Kind)+": "+strings.Join(c.Argv, " "))
+		}
+		return lines
+	}
+
+	commands, err := pool.AllCommands(nil)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"pool: zpool create -d -O compression=lz4 tank",
+		"dataset: zfs create tank/a",
+		"dataset: zfs create -o atime=off tank/a/b",
+		"bootfs: zpool set bootfs=tank/a/b tank",
+		"dataset: zfs create tank/clone",
+	}, summarize(commands))
+
+	commands, err = pool.AllCommands(NewFlagOptions(WithClones(true), WithSnapshots(true), WithCreateParents(true), WithExplicitInherit(true)))
+	assert.NoError(err)
+	assert.Equal([]string{
+		"pool: zpool create -d -O compression=lz4 tank",
+		"dataset: zfs create -p -o atime=off tank/a/b",
+		"bootfs: zpool set bootfs=tank/a/b tank",
+		"snapshot: zfs snapshot tank/a/b@s",
+		"dataset: zfs clone -p tank/a/b@s tank/clone",
+		"inherit: zfs inherit atime tank/clone",
+	}, summarize(commands))
+}
+
+func TestQuoters(t *testing.T) {
+	assert := require.New(t)
+
+	c := Command{Kind: CommandPool, Target: "tank", Argv: []string{"zpool", "create", "-o", "comment=it's a \\ pool", "-o", "x=", "tank", ""}}
+	assert.Equal(`zpool create -o 'comment=it'"'"'s a \ pool' -o x= tank ''`, c.Format(QuoteSh, false))
+	assert.Equal(`zpool create -o 'comment=it\'s a \\ pool' -o x= tank ''`, c.Format(QuoteFish, false))
+	assert.Equal(`zpool create -o comment=it's a \ pool -o x= tank `, c.Format(QuoteNone, false))
+	assert.Equal("zpool create \\\n  -o x \\\n  tank", Command{Target: "tank", Argv: []string{"zpool", "create", "-o", "x", "tank"}}.Format(QuoteNone, true))
+}
+
+func TestPreserveActive(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME  PROPERTY  VALUE       SOURCE
+tank  type      filesystem  -`), []byte(`NAME  PROPERTY                VALUE     SOURCE
+tank  feature@async_destroy   enabled   local
+tank  feature@lz4_compress    active    local
+tank  feature@zstd_compress   active    local
+tank  feature@draid           disabled  local`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	c, err := pool.PoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("", c.Comment)
+
+	c, err = pool.PoolCommand(NewFlagOptions(WithPreserveActive(true)))
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o feature@async_destroy=enabled -o feature@lz4_compress=enabled -o feature@zstd_compress=enabled tank", c.Oneline())
+	assert.Equal("active: feature@lz4_compress feature@zstd_compress", c.Comment)
+
+	c, err = pool.PoolCommand(NewFlagOptions(WithPreserveActive(true), WithExcludeProperties("feature@zstd_compress")))
+	assert.NoError(err)
+	assert.Equal("active: feature@lz4_compress", c.Comment)
+}
+
+func TestAnnotateProperties(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME    PROPERTY     VALUE       SOURCE
+tank    type         filesystem  -
+tank    compression  lz4         local
+tank/a  type         filesystem  -
+tank/a  compression  lz4         inherited from tank
+tank/a  atime        off         received`), []byte(`NAME  PROPERTY               VALUE   SOURCE
+tank  feature@lz4_compress   active  local
+tank  feature@bookmarks      enabled local`))
+	assert.NoError(err)
+	pool := pools["tank"]
+	opts := NewFlagOptions(WithAnnotateProperties(true))
+
+	c, err := pool.PoolCommand(opts)
+	assert.NoError(err)
+	assert.Equal("zpool create -d \\\n"+
+		"  -o feature@bookmarks=enabled `# local` \\\n"+
+		"  -o feature@lz4_compress=enabled `# was active` \\\n"+
+		"  -O compression=lz4 `# local` \\\n"+
+		"  tank", c.String())
+	assert.Equal("zpool create -d -o feature@bookmarks=enabled -o feature@lz4_compress=enabled -O compression=lz4 tank", c.Oneline())
+
+	c, err = pool.DatasetCommand("tank/a", opts)
+	assert.NoError(err)
+	assert.Equal("zfs create \\\n  -o atime=off `# received` \\\n  tank/a", c.String())
+
+	// Notes stay on their arguments behind a prefix
+	prefixed := c.WithPrefix("sudo", "-n")
+	assert.Equal("sudo -n zfs create \\\n  -o atime=off `# received` \\\n  tank/a", prefixed.String())
+	assert.Equal([]string{"zfs", "create", "-o", "atime=off", "tank/a"}, c.Argv)
+
+	c, err = pool.DatasetCommand("tank/a", nil)
+	assert.NoError(err)
+	assert.Nil(c.Notes)
+}
@@ -0,0 +1,56 @@
+package zfs
+
+import "path"
+
+// DestroyCommands returns the commands destroying the named datasets of p,
+// dependents before the datasets they depend on. A dataset is destroyed with
+// -r if all of its descendants are named, covering them too. The pool is
+// destroyed last, once the datasets inside it are, if every dataset is named.
+func (p *Pool) DestroyCommands(names []string) (cmdlines [][]string, err error) {
+	ordered, err := p.OrderedDatasets()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	recursive := make(map[string]bool, len(ordered))
+	for _, d := range ordered {
+		recursive[d.Name] = selected[d.Name]
+	}
+	for _, d := range ordered {
+		if selected[d.Name] {
+			continue
+		}
+		for dir := path.Dir(d.Name); dir != "."; dir = path.Dir(dir) {
+			recursive[dir] = false
+		}
+	}
+
+	for i := len(ordered) - 1; i >= 0; i-- {
+		d := ordered[i]
+		if !selected[d.Name] || isRootDataset(d.Name) {
+			continue
+		}
+		if parent := path.Dir(d.Name); recursive[parent] && !isRootDataset(parent) {
+			continue
+		}
+		if recursive[d.Name] {
+			cmdlines = append(cmdlines, []string{"zfs", "destroy", "-r", d.Name})
+		} else {
+			cmdlines = append(cmdlines, []string{"zfs", "destroy", d.Name})
+		}
+	}
+
+	if selected[p.Name] {
+		if recursive[p.Name] {
+			cmdlines = append(cmdlines, []string{"zpool", "destroy", p.Name})
+		} else {
+			Warnf("not destroying pool %s, as some of its datasets are to be kept", p.Name)
+		}
+	}
+	return cmdlines, nil
+}
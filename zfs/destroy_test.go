@@ -0,0 +1,55 @@
+package zfs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestroyCommands(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME          PROPERTY  VALUE        SOURCE
+tank          type      filesystem   -
+tank/a        type      filesystem   -
+tank/a/b      type      filesystem   -
+tank/base     type      filesystem   -
+tank/base@s   type      snapshot     -
+tank/clone    type      filesystem   -
+tank/clone    origin    tank/base@s  -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+
+	destroy := func(names ...string) (out []string) {
+		cmdlines, err := pool.DestroyCommands(names)
+		assert.NoError(err)
+		for _, cmdline := range cmdlines {
+			out = append(out, strings.Join(cmdline, " "))
+		}
+		return out
+	}
+
+	// The clone goes before the dataset holding its origin
+	assert.Equal([]string{
+		"zfs destroy -r tank/clone",
+		"zfs destroy -r tank/base",
+		"zfs destroy -r tank/a",
+		"zpool destroy tank",
+	}, destroy("tank", "tank/a", "tank/a/b", "tank/base", "tank/clone"))
+
+	assert.Equal([]string{"zfs destroy -r tank/a"}, destroy("tank/a", "tank/a/b"))
+	assert.Equal([]string{"zfs destroy tank/a"}, destroy("tank/a"))
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	assert.Equal([]string{"zfs destroy -r tank/a"}, destroy("tank", "tank/a", "tank/a/b"))
+	assert.Equal([]string{"not destroying pool tank, as some of its datasets are to be kept"}, warnings)
+}
@@ -0,0 +1,104 @@
+package zfs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type DeviceNaming int
+
+const (
+	// Leave device paths as reported by zpool status -P
+	DeviceAsReported DeviceNaming = iota
+	DeviceByDev
+	DeviceById
+	DeviceByPath
+	DeviceByVdev
+)
+
+// Directory containing the by-id, by-path, and by-vdev symlink namespaces
+var deviceDir = "/dev/disk"
+
+var deviceNamespaces = map[DeviceNaming]string{
+	DeviceById:   "by-id",
+	DeviceByPath: "by-path",
+	DeviceByVdev: "by-vdev",
+}
+
+type deviceResolver struct {
+	naming DeviceNaming
+	// Maps canonical device paths to their alias in the requested namespace
+	aliases map[string]string
+}
+
+func newDeviceResolver(naming DeviceNaming) *deviceResolver {
+	r := &deviceResolver{naming: naming}
+
+	ns, ok := deviceNamespaces[naming]
+	if !ok {
+		return r
+	}
+
+	r.aliases = make(map[string]string)
+	dir := filepath.Join(deviceDir, ns)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return r
+	}
+
+	// Sorted so that devices with several aliases resolve deterministically
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		alias := filepath.Join(dir, name)
+		dev, err := filepath.EvalSymlinks(alias)
+		if err != nil {
+			continue
+		}
+		if _, ok := r.aliases[dev]; !ok {
+			r.aliases[dev] = alias
+		}
+	}
+
+	return r
+}
+
+func (r *deviceResolver) resolve(dev string) string {
+	if r == nil || r.naming == DeviceAsReported {
+		return dev
+	}
+
+	canonical, err := filepath.EvalSymlinks(dev)
+	if err != nil {
+		Warnf("unable to resolve device %s: %s", dev, err)
+		return dev
+	}
+
+	if r.naming == DeviceByDev {
+		return canonical
+	}
+
+	alias, ok := r.aliases[canonical]
+	if !ok {
+		Warnf("no %s alias found for device %s", deviceNamespaces[r.naming], dev)
+		return dev
+	}
+	return alias
+}
+
+// Returns the directory zpool import -d should search for devices named with
+// naming, or "" to search the default locations
+func (naming DeviceNaming) importDir() string {
+	if naming == DeviceByDev {
+		return "/dev"
+	}
+	if ns, ok := deviceNamespaces[naming]; ok {
+		return filepath.Join(deviceDir, ns)
+	}
+	return ""
+}
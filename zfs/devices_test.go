@@ -0,0 +1,59 @@
+package zfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceResolver(t *testing.T) {
+	assert := require.New(t)
+
+	dev := t.TempDir()
+	defer func(d string) { deviceDir = d }(deviceDir)
+	deviceDir = filepath.Join(dev, "disk")
+
+	sda := filepath.Join(dev, "sda1")
+	sdb := filepath.Join(dev, "sdb1")
+	byId := filepath.Join(deviceDir, "by-id")
+	assert.NoError(os.MkdirAll(byId, 0755))
+	assert.NoError(os.WriteFile(sda, nil, 0644))
+	assert.NoError(os.WriteFile(sdb, nil, 0644))
+	assert.NoError(os.Symlink("../../sda1", filepath.Join(byId, "wwn-0x5000-part1")))
+	assert.NoError(os.Symlink("../../sda1", filepath.Join(byId, "ata-DISK_A-part1")))
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	vdevs := &Vdevs{Data: []*VdevGroup{{Kind: "mirror", Children: []string{
+		filepath.Join(byId, "wwn-0x5000-part1"),
+		sdb,
+	}}}}
+
+	assert.Equal([]string{"mirror", filepath.Join(byId, "wwn-0x5000-part1"), sdb}, vdevs.args(&FlagOptions{}))
+	assert.Equal([]string{"mirror", sda, sdb}, vdevs.args(&FlagOptions{DeviceNaming: DeviceByDev}))
+	assert.Empty(warnings)
+
+	assert.Equal([]string{"mirror", filepath.Join(byId, "ata-DISK_A-part1"), sdb}, vdevs.args(&FlagOptions{DeviceNaming: DeviceById}))
+	assert.Equal([]string{"no by-id alias found for device " + sdb}, warnings)
+
+	warnings = nil
+	assert.Equal([]string{"mirror", filepath.Join(byId, "wwn-0x5000-part1"), sdb}, vdevs.args(&FlagOptions{DeviceNaming: DeviceByPath}))
+	assert.Len(warnings, 2)
+}
+
+func TestImportPoolCommand(t *testing.T) {
+	assert := require.New(t)
+
+	pool := &Pool{Name: "tank"}
+	assert.Equal([]string{"zpool", "import", "tank"}, pool.ImportPoolCommand(nil))
+	assert.Equal([]string{"zpool", "import", "-d", "/dev", "tank"}, pool.ImportPoolCommand(&FlagOptions{DeviceNaming: DeviceByDev}))
+	assert.Equal([]string{"zpool", "import", "-d", "/dev/disk/by-id", "tank"}, pool.ImportPoolCommand(&FlagOptions{DeviceNaming: DeviceById}))
+	assert.Equal([]string{"zpool", "import", "-d", "/dev/disk/by-vdev", "tank"}, pool.ImportPoolCommand(&FlagOptions{DeviceNaming: DeviceByVdev}))
+}
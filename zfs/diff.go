@@ -0,0 +1,92 @@
+package zfs
+
+import (
+	"sort"
+)
+
+// ChangeKind describes how a pool, dataset, or property differs
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+// Change is a single difference between two sets of pools. Property is empty
+// when a whole pool or dataset was added or removed, and Old or New is empty
+// when a property is only present on one side.
+type Change struct {
+	Kind ChangeKind
+	// pool or dataset
+	Type     string
+	Name     string
+	Property string
+	Old, New string
+}
+
+// Diff compares two sets of pools, ignoring status properties and snapshots.
+// Changes are sorted by name, then type, then property.
+func Diff(old, new map[string]*Pool) (changes []Change) {
+	for name, o := range old {
+		n, ok := new[name]
+		if !ok {
+			changes = append(changes, Change{Kind: ChangeRemoved, Type: "pool", Name: name})
+			continue
+		}
+		changes = append(changes, diffProperties("pool", name, o.Properties, n.Properties)...)
+
+		for _, d := range o.Datasets.Ordered {
+			nd, ok := n.Datasets.Index[d.Name]
+			if !ok {
+				changes = append(changes, Change{Kind: ChangeRemoved, Type: "dataset", Name: d.Name})
+				continue
+			}
+			changes = append(changes, diffProperties("dataset", d.Name, d.Properties, nd.Properties)...)
+		}
+		for _, d := range n.Datasets.Ordered {
+			if _, ok := o.Datasets.Index[d.Name]; !ok {
+				changes = append(changes, Change{Kind: ChangeAdded, Type: "dataset", Name: d.Name})
+			}
+		}
+	}
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			changes = append(changes, Change{Kind: ChangeAdded, Type: "pool", Name: name})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Type != b.Type {
+			return a.Type > b.Type
+		}
+		return a.Property < b.Property
+	})
+	return changes
+}
+
+func diffProperties(typ, name string, old, new map[string]*Property) (changes []Change) {
+	for propName, o := range old {
+		if o.statusOnly() {
+			continue
+		}
+		c := Change{Kind: ChangeChanged, Type: typ, Name: name, Property: propName, Old: o.Value()}
+		if n, ok := new[propName]; ok {
+			if n.Value() == c.Old {
+				continue
+			}
+			c.New = n.Value()
+		}
+		changes = append(changes, c)
+	}
+	for propName, n := range new {
+		if _, ok := old[propName]; !ok && !n.statusOnly() {
+			changes = append(changes, Change{Kind: ChangeChanged, Type: typ, Name: name, Property: propName, New: n.Value()})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,60 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	assert := require.New(t)
+
+	parse := func(zpool, zfs string) map[string]*Pool {
+		poolProps, err := zpoolParse([]byte(zpool))
+		assert.NoError(err)
+		pools, err := parseGetAll([]byte(zfs), poolProps)
+		assert.EqualError(err, "end of input")
+		return pools
+	}
+
+	old := parse(`NAME  PROPERTY  VALUE    SOURCE
+tank  comment   old      local
+tank  size      10G      -
+gone  comment   -        default`, `NAME        PROPERTY     VALUE       SOURCE
+gone        type         filesystem  -
+tank        type         filesystem  -
+tank        used         1G          -
+tank        compression  lz4         local
+tank/a      type         filesystem  -
+tank/a      compression  lz4         inherited from tank
+tank/a      atime        off         local
+tank/a@s    type         snapshot    -
+tank/b      type         filesystem  -`)
+
+	new := parse(`NAME  PROPERTY  VALUE    SOURCE
+tank  comment   new      local
+tank  size      20G      -
+made  comment   -        default`, `NAME        PROPERTY     VALUE       SOURCE
+made        type         filesystem  -
+tank        type         filesystem  -
+tank        used         2G          -
+tank        compression  zstd        local
+tank/a      type         filesystem  -
+tank/a      compression  zstd        inherited from tank
+tank/a      recordsize   1M          local
+tank/c      type         filesystem  -`)
+
+	assert.Equal([]Change{
+		{Kind: ChangeRemoved, Type: "pool", Name: "gone"},
+		{Kind: ChangeAdded, Type: "pool", Name: "made"},
+		{Kind: ChangeChanged, Type: "pool", Name: "tank", Property: "comment", Old: "old", New: "new"},
+		{Kind: ChangeChanged, Type: "dataset", Name: "tank", Property: "compression", Old: "lz4", New: "zstd"},
+		{Kind: ChangeChanged, Type: "dataset", Name: "tank/a", Property: "atime", Old: "off"},
+		{Kind: ChangeChanged, Type: "dataset", Name: "tank/a", Property: "compression", Old: "lz4", New: "zstd"},
+		{Kind: ChangeChanged, Type: "dataset", Name: "tank/a", Property: "recordsize", New: "1M"},
+		{Kind: ChangeRemoved, Type: "dataset", Name: "tank/b"},
+		{Kind: ChangeAdded, Type: "dataset", Name: "tank/c"},
+	}, Diff(old, new))
+
+	assert.Empty(Diff(old, old))
+}
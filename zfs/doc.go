@@ -0,0 +1,12 @@
+// Package zfs infers the zpool and zfs commands that recreate pools and their
+// datasets from their current properties.
+//
+// ParseProperties parses captured zfs get all and zpool get all output, while
+// ImportedPools and its variants run zfs and zpool on the host. Either returns
+// pools keyed by name, from which Pool.CreatePoolCommand,
+// Pool.CreateDatasetCommand, and the other Pool methods build commands.
+// These, and the types they return, are the supported API.
+//
+// The package is derived from github.com/josephvusich/go-zfs under the
+// Apache License 2.0, see LICENSE and NOTICE.
+package zfs
@@ -0,0 +1,46 @@
+package zfs
+
+import "fmt"
+
+// UnparseableLineError is a line of zfs get output that is not a property
+type UnparseableLineError struct {
+	Line string
+	// Counting from 1, including the header
+	LineNum int
+}
+
+func (e *UnparseableLineError) Error() string {
+	return fmt.Sprintf("line %d: unparseable input: %s", e.LineNum, e.Line)
+}
+
+// DuplicateDatasetError is a dataset listed twice in a pool
+type DuplicateDatasetError struct {
+	Pool string
+	Name string
+}
+
+func (e *DuplicateDatasetError) Error() string {
+	return fmt.Sprintf("%s already contains a dataset named %s", e.Pool, e.Name)
+}
+
+// DuplicatePoolError is a pool listed twice in zpool get or zpool status output
+type DuplicatePoolError struct {
+	Name string
+}
+
+func (e *DuplicatePoolError) Error() string {
+	return fmt.Sprintf("duplicate zpool found: %s", e.Name)
+}
+
+// InheritanceMismatchError is an inherited property whose value differs from
+// that of the parent it is inherited from
+type InheritanceMismatchError struct {
+	Property    string
+	Parent      string
+	Value       string
+	ParentValue string
+}
+
+func (e *InheritanceMismatchError) Error() string {
+	return fmt.Sprintf("inherited property %s does not match value on parent %s: %s != %s", e.Property, e.Parent, e.Value, e.ParentValue)
+}
@@ -0,0 +1,68 @@
+package zfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Snapshots passed to each zfs holds, keeping its command line well below
+// ARG_MAX even for long snapshot names
+var holdsBatchSize = 256
+
+func zfsHoldsRaw(r CommandRunner, snapshots []string) ([]byte, error) {
+	return r.Run(`zfs`, append([]string{`holds`, `-H`}, snapshots...)...)
+}
+
+// Returns hold tags by snapshot name from zfs holds -H output
+func parseHolds(b []byte) (map[string][]string, error) {
+	holds := make(map[string][]string)
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		fields := strings.Split(l, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unparseable hold: %s", l)
+		}
+		holds[fields[0]] = append(holds[fields[0]], fields[1])
+	}
+	return holds, nil
+}
+
+// Returns the names of snapshots with at least one user hold
+func heldSnapshots(pools map[string]*Pool) (held []string) {
+	for _, pool := range pools {
+		for _, set := range pool.Datasets.Ordered {
+			for _, s := range set.Snapshots {
+				if refs, ok := s.Properties["userrefs"]; ok && refs.Value() != "0" && refs.Value() != "-" {
+					held = append(held, s.Name)
+				}
+			}
+		}
+	}
+	sort.Strings(held)
+	return held
+}
+
+func attachHolds(pools map[string]*Pool, holds map[string][]string) {
+	for name, tags := range holds {
+		snap := findSnapshot(pools, name)
+		if snap == nil {
+			Warnf("ignoring holds on unknown snapshot %s", name)
+			continue
+		}
+		snap.Holds = tags
+	}
+}
+
+func (p *Pool) CreateHoldCommand(snapshot, tag string) (cmdline []string, err error) {
+	if snap := findSnapshot(map[string]*Pool{p.Name: p}, snapshot); snap != nil {
+		for _, t := range snap.Holds {
+			if t == tag {
+				return []string{"zfs", "hold", tag, snapshot}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("hold %s not found on snapshot %s", tag, snapshot)
+}
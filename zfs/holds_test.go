@@ -0,0 +1,81 @@
+package zfs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHolds(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	runner := fakeRunner{
+		"zpool get all": `NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    0      default
+`,
+		"zfs get all": `NAME          PROPERTY  VALUE       SOURCE
+tank          type      filesystem  -
+tank@a        type      snapshot    -
+tank@a        userrefs  2           -
+tank@b        type      snapshot    -
+tank@b        userrefs  0           -
+tank/home     type      filesystem  -
+tank/home@c   type      snapshot    -
+tank/home@c   userrefs  1           -
+`,
+		"zfs holds -H tank/home@c tank@a": "tank@a\tkeep\tSun Dec  4  0:24 2022\n" +
+			"tank@a\treplication\tSun Dec  4  0:25 2022\n" +
+			"tank/home@c\tkeep\tSun Dec  4  0:26 2022\n" +
+			"tank/home@gone\tkeep\tSun Dec  4  0:27 2022\n",
+	}
+
+	in := RunnerInput(runner)
+	in.ZpoolStatus = nil
+	pools, err := ImportedPoolsFrom(in)
+	assert.NoError(err)
+	assert.Empty(pools["tank"].Datasets.Index["tank"].Snapshots[0].Holds)
+
+	in.ZfsHolds = HoldsRunner(runner)
+	pools, err = ImportedPoolsFrom(in)
+	assert.NoError(err)
+	assert.Equal([]string{"ignoring holds on unknown snapshot tank/home@gone"}, warnings)
+
+	pool := pools["tank"]
+	assert.Equal([]string{"keep", "replication"}, pool.Datasets.Index["tank"].Snapshots[0].Holds)
+	assert.Empty(pool.Datasets.Index["tank"].Snapshots[1].Holds)
+	assert.Equal([]string{"keep"}, pool.Datasets.Index["tank/home"].Snapshots[0].Holds)
+
+	cmdline, err := pool.CreateHoldCommand("tank@a", "replication")
+	assert.NoError(err)
+	assert.Equal([]string{"zfs", "hold", "replication", "tank@a"}, cmdline)
+
+	_, err = pool.CreateHoldCommand("tank@b", "keep")
+	assert.EqualError(err, "hold keep not found on snapshot tank@b")
+
+	// One zfs holds per batch of snapshots
+	defer func(n int) { holdsBatchSize = n }(holdsBatchSize)
+	holdsBatchSize = 1
+	warnings = nil
+	delete(runner, "zfs holds -H tank/home@c tank@a")
+	runner["zfs holds -H tank/home@c"] = "tank/home@c\tkeep\tSun Dec  4  0:26 2022\n"
+	runner["zfs holds -H tank@a"] = "tank@a\tkeep\tSun Dec  4  0:24 2022\n"
+	pools, err = ImportedPoolsFrom(in)
+	assert.NoError(err)
+	assert.Empty(warnings)
+	assert.Equal([]string{"keep"}, pools["tank"].Datasets.Index["tank"].Snapshots[0].Holds)
+	assert.Equal([]string{"keep"}, pools["tank"].Datasets.Index["tank/home"].Snapshots[0].Holds)
+
+	delete(runner, "zfs holds -H tank@a")
+	_, err = ImportedPoolsFrom(in)
+	assert.EqualError(err, "zfs holds: unexpected command: zfs holds -H tank@a")
+
+	_, err = parseHolds([]byte("tank@a keep\n"))
+	assert.EqualError(err, "unparseable hold: tank@a keep")
+}
@@ -0,0 +1,33 @@
+package zfs
+
+import "sync"
+
+// Inventory holds the imported pools of a host between calls to Refresh, for
+// long-running callers that poll. It is safe for concurrent use.
+type Inventory struct {
+	mu    sync.RWMutex
+	pools map[string]*Pool
+}
+
+// Pools returns the pools found by the last successful Refresh, or nil before
+// the first. The map is replaced rather than modified by Refresh, so it may be
+// read without further locking but must not be modified.
+func (inv *Inventory) Pools() map[string]*Pool {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	return inv.pools
+}
+
+// Refresh re-queries the imported pools with r and replaces the map returned
+// by Pools. If the query fails, the previous pools are kept.
+func (inv *Inventory) Refresh(r CommandRunner) error {
+	pools, err := ImportedPoolsWith(r)
+	if err != nil {
+		return err
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.pools = pools
+	return nil
+}
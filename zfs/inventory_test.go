@@ -0,0 +1,58 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventory(t *testing.T) {
+	assert := require.New(t)
+
+	runner := fakeRunner{
+		"zpool get all": `NAME  PROPERTY               VALUE    SOURCE
+tank  feature@async_destroy  enabled  local
+`,
+		"zfs get all": `NAME       PROPERTY     VALUE       SOURCE
+tank       type         filesystem  -
+tank/home  type         filesystem  -
+`,
+		"zpool status -P": `  pool: tank
+ state: ONLINE
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  /dev/sda  ONLINE       0     0     0
+
+errors: No known data errors
+`,
+		"zdb -C tank": `tank:
+    vdev_tree:
+        type: 'root'
+        children[0]:
+            type: 'disk'
+            ashift: 12
+            is_log: 0
+`,
+	}
+
+	var inv Inventory
+	assert.Nil(inv.Pools())
+
+	assert.NoError(inv.Refresh(runner))
+	first := inv.Pools()
+	assert.Len(first["tank"].Datasets.Ordered, 2)
+
+	runner["zfs get all"] += `tank/srv   type         filesystem  -
+`
+	assert.NoError(inv.Refresh(runner))
+	assert.Len(inv.Pools()["tank"].Datasets.Ordered, 3)
+	// Earlier maps are left as they were
+	assert.Len(first["tank"].Datasets.Ordered, 2)
+
+	second := inv.Pools()
+	delete(runner, "zfs get all")
+	assert.EqualError(inv.Refresh(runner), "zfs get all: unexpected command: zfs get all")
+	assert.Equal(second, inv.Pools())
+}
@@ -0,0 +1,124 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Output of zfs get -j and zpool get -j, available since OpenZFS 2.3
+type jsonGet struct {
+	Datasets map[string]jsonObject `json:"datasets"`
+	Pools    map[string]jsonObject `json:"pools"`
+}
+
+type jsonObject struct {
+	Properties map[string]struct {
+		// A string, or a number with --json-int
+		Value  interface{} `json:"value"`
+		Source struct {
+			Type string `json:"type"`
+			Data string `json:"data"`
+		} `json:"source"`
+	} `json:"properties"`
+}
+
+// Source types as printed in the SOURCE column of get -H
+var jsonSources = map[string]string{
+	"NONE":      "-",
+	"DEFAULT":   "default",
+	"LOCAL":     "local",
+	"RECEIVED":  "received",
+	"TEMPORARY": "temporary",
+	"INHERITED": "inherited from ",
+}
+
+// Sorts parents before children, and snapshots and bookmarks directly after
+// their dataset, as zfs get all does
+func jsonOrder(name string) string {
+	return strings.NewReplacer("@", "\x00", "#", "\x00", "/", "\x01").Replace(name)
+}
+
+// Converts get -j output into the equivalent get -H output. Its objects are
+// unordered, so all of them are decoded before any line is written.
+func jsonToTabs(r io.Reader) ([]byte, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var get jsonGet
+	if err := dec.Decode(&get); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+
+	objects := get.Datasets
+	if objects == nil {
+		objects = get.Pools
+	}
+
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return jsonOrder(names[i]) < jsonOrder(names[j]) })
+
+	var out bytes.Buffer
+	for _, name := range names {
+		props := objects[name].Properties
+		propNames := make([]string, 0, len(props))
+		for propName := range props {
+			propNames = append(propNames, propName)
+		}
+		sort.Strings(propNames)
+
+		for _, propName := range propNames {
+			prop := props[propName]
+			source, ok := jsonSources[prop.Source.Type]
+			if !ok {
+				return nil, fmt.Errorf("%s property source for %s is invalid: %s", name, propName, prop.Source.Type)
+			}
+			if prop.Source.Type == "INHERITED" {
+				source += prop.Source.Data
+			}
+
+			value := fmt.Sprint(prop.Value)
+			if strings.ContainsAny(value, "\t\n") {
+				return nil, fmt.Errorf("%s property %s has an unsupported value: %q", name, propName, value)
+			}
+			fmt.Fprintf(&out, "%s\t%s\t%s\t%s\n", name, propName, value, source)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// Reports whether the first non-space byte buffered in r opens a JSON object
+func peekJSON(r *bufio.Reader) bool {
+	for n := 1; ; n++ {
+		b, err := r.Peek(n)
+		if err != nil {
+			return false
+		}
+		switch c := b[n-1]; c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c == '{'
+		}
+	}
+}
+
+// Returns the equivalent get -H output if r holds get -j output, or otherwise r
+func jsonReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if !peekJSON(br) {
+		return br, nil
+	}
+
+	b, err := jsonToTabs(br)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
@@ -0,0 +1,136 @@
+package zfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONInput(t *testing.T) {
+	assert := require.New(t)
+
+	runner := fakeRunner{
+		"zpool get -j all": `{
+  "output_version": {"command": "zpool get", "vers_major": 0, "vers_minor": 1},
+  "pools": {
+    "tank": {
+      "name": "tank",
+      "type": "POOL",
+      "state": "ONLINE",
+      "properties": {
+        "size": {"value": "9.50G", "source": {"type": "NONE", "data": "-"}},
+        "comment": {"value": "primary  backup", "source": {"type": "LOCAL", "data": "-"}},
+        "ashift": {"value": "12", "source": {"type": "LOCAL", "data": "-"}},
+        "feature@lz4_compress": {"value": "active", "source": {"type": "LOCAL", "data": "-"}}
+      }
+    },
+    "tank-2": {
+      "name": "tank-2",
+      "type": "POOL",
+      "state": "ONLINE",
+      "properties": {
+        "ashift": {"value": "0", "source": {"type": "DEFAULT", "data": "-"}}
+      }
+    }
+  }
+}`,
+		"zfs get -j all": `{
+  "output_version": {"command": "zfs get", "vers_major": 0, "vers_minor": 1},
+  "datasets": {
+    "tank/home@a": {
+      "name": "tank/home@a",
+      "type": "SNAPSHOT",
+      "dataset": "tank/home",
+      "snapshot_name": "a",
+      "properties": {
+        "type": {"value": "snapshot", "source": {"type": "NONE", "data": "-"}},
+        "createtxg": {"value": 12, "source": {"type": "NONE", "data": "-"}},
+        "creation": {"value": "1670113441", "source": {"type": "NONE", "data": "-"}}
+      }
+    },
+    "tank/home": {
+      "name": "tank/home",
+      "type": "FILESYSTEM",
+      "properties": {
+        "type": {"value": "filesystem", "source": {"type": "NONE", "data": "-"}},
+        "compression": {"value": "lz4", "source": {"type": "INHERITED", "data": "tank"}},
+        "atime": {"value": "off", "source": {"type": "LOCAL", "data": "-"}}
+      }
+    },
+    "tank-2": {
+      "name": "tank-2",
+      "type": "FILESYSTEM",
+      "properties": {
+        "type": {"value": "filesystem", "source": {"type": "NONE", "data": "-"}}
+      }
+    },
+    "tank": {
+      "name": "tank",
+      "type": "FILESYSTEM",
+      "properties": {
+        "type": {"value": "filesystem", "source": {"type": "NONE", "data": "-"}},
+        "compression": {"value": "lz4", "source": {"type": "LOCAL", "data": "-"}},
+        "recordsize": {"value": "128K", "source": {"type": "DEFAULT", "data": "-"}}
+      }
+    }
+  }
+}`,
+	}
+
+	b, err := jsonToTabs(strings.NewReader(runner["zfs get -j all"]))
+	assert.NoError(err)
+	assert.Equal("tank\tcompression\tlz4\tlocal\n"+
+		"tank\trecordsize\t128K\tdefault\n"+
+		"tank\ttype\tfilesystem\t-\n"+
+		"tank/home\tatime\toff\tlocal\n"+
+		"tank/home\tcompression\tlz4\tinherited from tank\n"+
+		"tank/home\ttype\tfilesystem\t-\n"+
+		"tank/home@a\tcreatetxg\t12\t-\n"+
+		"tank/home@a\tcreation\t1670113441\t-\n"+
+		"tank/home@a\ttype\tsnapshot\t-\n"+
+		"tank-2\ttype\tfilesystem\t-\n", string(b))
+
+	in := JSONInput(runner)
+	in.ZpoolStatus = nil
+	pools, err := ImportedPoolsFrom(in)
+	assert.NoError(err)
+	assert.Len(pools, 2)
+
+	// DetectInput reads JSON only where zfs version allows it
+	runner["zfs version"] = "zfs-2.3.0-1\nzfs-kmod-2.3.0-1\n"
+	in = DetectInput(runner)
+	in.ZpoolStatus = nil
+	pools, err = ImportedPoolsFrom(in)
+	assert.NoError(err)
+	assert.Len(pools, 2)
+
+	runner["zfs version"] = "zfs-2.2.6-1\nzfs-kmod-2.2.6-1\n"
+	in = DetectInput(runner)
+	in.ZpoolStatus = nil
+	_, err = ImportedPoolsFrom(in)
+	assert.Error(err)
+	assert.Regexp(`unexpected command: (zfs|zpool) get all$`, err.Error())
+
+	cmdline, err := pools["tank"].CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"zpool", "create", "-d",
+		"-o", "ashift=12",
+		"-o", "feature@lz4_compress=enabled",
+		"-O", "compression=lz4",
+		"tank",
+	}, cmdline)
+	assert.Equal([][]string{{"zpool", "set", "comment=primary  backup", "tank"}}, pools["tank"].SetPropertyCommands(nil))
+
+	cmdline, err = pools["tank"].CreateDatasetCommand("tank/home", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o atime=off tank/home", strings.Join(cmdline, " "))
+	assert.Len(pools["tank"].Datasets.Index["tank/home"].Snapshots, 1)
+
+	_, err = jsonToTabs(strings.NewReader(`{"datasets": {"tank": {"properties": {"atime": {"value": "on", "source": {"type": "BOGUS"}}}}}}`))
+	assert.EqualError(err, "tank property source for atime is invalid: BOGUS")
+
+	_, err = parseGetAll([]byte(`{"datasets": `), nil)
+	assert.EqualError(err, "invalid json: unexpected EOF")
+}
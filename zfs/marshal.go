@@ -0,0 +1,67 @@
+package zfs
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Returns the source as printed in the SOURCE column of zfs get, such as
+// default or inherited from tank
+func (s PropertySource) String() string {
+	switch s.Location {
+	case PropertyDefault:
+		return "default"
+	case PropertyLocal:
+		return "local"
+	case PropertyInherited:
+		return "inherited from " + s.Parent
+	case PropertyReceived:
+		return "received"
+	case PropertyTemporary:
+		return "temporary"
+	default:
+		return "-"
+	}
+}
+
+type jsonProperty struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Only the name of the parent of an inherited property is emitted, so the
+// value is resolved rather than following Source.Inherited
+func (p *Property) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonProperty{Name: p.Name, Value: p.Value(), Source: p.Source.String()})
+}
+
+// Returns properties sorted by name
+func propertyList(props map[string]*Property) sortedProperties {
+	sorted := make(sortedProperties, 0, len(props))
+	for _, prop := range props {
+		sorted = append(sorted, prop)
+	}
+	sort.Sort(sorted)
+	return sorted
+}
+
+type jsonDataset struct {
+	Name       string           `json:"name"`
+	Properties sortedProperties `json:"properties"`
+}
+
+func (d *Dataset) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonDataset{Name: d.Name, Properties: propertyList(d.Properties)})
+}
+
+type jsonPool struct {
+	Name       string           `json:"name"`
+	Properties sortedProperties `json:"properties"`
+	// Ordered by creation
+	Datasets []*Dataset `json:"datasets"`
+}
+
+func (p *Pool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonPool{Name: p.Name, Properties: propertyList(p.Properties), Datasets: p.Datasets.Ordered})
+}
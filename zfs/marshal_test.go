@@ -0,0 +1,43 @@
+package zfs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME       PROPERTY     VALUE       SOURCE
+tank       type         filesystem  -
+tank       compression  lz4         local
+tank/home  type         filesystem  -
+tank/home  compression  lz4         inherited from tank
+tank/home  atime        off         received`), []byte(`NAME  PROPERTY  VALUE   SOURCE
+tank  comment   backup  local
+tank  ashift    0       default`))
+	assert.NoError(err)
+
+	b, err := json.Marshal(pools)
+	assert.NoError(err)
+	assert.JSONEq(`{"tank": {
+  "name": "tank",
+  "properties": [
+    {"name": "ashift", "value": "0", "source": "default"},
+    {"name": "comment", "value": "backup", "source": "local"}
+  ],
+  "datasets": [
+    {"name": "tank", "properties": [
+      {"name": "compression", "value": "lz4", "source": "local"},
+      {"name": "type", "value": "filesystem", "source": "-"}
+    ]},
+    {"name": "tank/home", "properties": [
+      {"name": "atime", "value": "off", "source": "received"},
+      {"name": "compression", "value": "lz4", "source": "inherited from tank"},
+      {"name": "type", "value": "filesystem", "source": "-"}
+    ]}
+  ]
+}}`, string(b))
+}
@@ -0,0 +1,110 @@
+package zfs
+
+// FlagOption sets a field of FlagOptions, see NewFlagOptions
+type FlagOption func(*FlagOptions)
+
+// NewFlagOptions returns the options used when FlagOptions is nil, with opts
+// applied in order. Unlike a FlagOptions literal, callers keep these defaults
+// as fields are added.
+func NewFlagOptions(opts ...FlagOption) *FlagOptions {
+	o := *defaultFlagOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &o
+}
+
+func WithPreserveActive(preserve bool) FlagOption {
+	return func(o *FlagOptions) { o.PreserveActive = preserve }
+}
+
+func WithAnnotateProperties(annotate bool) FlagOption {
+	return func(o *FlagOptions) { o.AnnotateProperties = annotate }
+}
+
+// All features are disabled at creation by default
+func WithDisableAllFeatures(disable bool) FlagOption {
+	return func(o *FlagOptions) { o.DisableAllFeatures = disable }
+}
+
+func WithMinimalFeatures(minimal bool) FlagOption {
+	return func(o *FlagOptions) { o.MinimalFeatures = minimal }
+}
+
+func WithDeviceNaming(naming DeviceNaming) FlagOption {
+	return func(o *FlagOptions) { o.DeviceNaming = naming }
+}
+
+func WithClones(clones bool) FlagOption {
+	return func(o *FlagOptions) { o.Clones = clones }
+}
+
+func WithNoMount(noMount bool) FlagOption {
+	return func(o *FlagOptions) { o.NoMount = noMount }
+}
+
+func WithAltroot(altroot bool) FlagOption {
+	return func(o *FlagOptions) { o.IncludeAltroot = altroot }
+}
+
+// Received properties are included by default
+func WithReceived(received bool) FlagOption {
+	return func(o *FlagOptions) { o.IncludeReceived = received }
+}
+
+func WithCreateParents(parents bool) FlagOption {
+	return func(o *FlagOptions) { o.CreateParents = parents }
+}
+
+// Only the named properties are emitted
+func WithIncludeProperties(names ...string) FlagOption {
+	return func(o *FlagOptions) { o.IncludeProperties = names }
+}
+
+// The named properties are never emitted
+func WithExcludeProperties(names ...string) FlagOption {
+	return func(o *FlagOptions) { o.ExcludeProperties = names }
+}
+
+func WithOnlyLocal(local bool) FlagOption {
+	return func(o *FlagOptions) { o.OnlyLocal = local }
+}
+
+func WithNoUserProperties(noUser bool) FlagOption {
+	return func(o *FlagOptions) { o.NoUserProperties = noUser }
+}
+
+func WithNoShares(noShares bool) FlagOption {
+	return func(o *FlagOptions) { o.NoShares = noShares }
+}
+
+// Emits uri as the keylocation of the encryption root name, or if name is ""
+// of every encryption root with keylocation=prompt
+func WithKeyLocation(name, uri string) FlagOption {
+	return func(o *FlagOptions) {
+		if o.KeyLocations == nil {
+			o.KeyLocations = map[string]string{}
+		}
+		o.KeyLocations[name] = uri
+	}
+}
+
+func WithLoadKeys(load bool) FlagOption {
+	return func(o *FlagOptions) { o.LoadKeys = load }
+}
+
+func WithExplicitInherit(explicit bool) FlagOption {
+	return func(o *FlagOptions) { o.ExplicitInherit = explicit }
+}
+
+func WithSnapshots(snapshots bool) FlagOption {
+	return func(o *FlagOptions) { o.Snapshots = snapshots }
+}
+
+func WithHolds(holds bool) FlagOption {
+	return func(o *FlagOptions) { o.Holds = holds }
+}
+
+func WithBookmarks(bookmarks bool) FlagOption {
+	return func(o *FlagOptions) { o.Bookmarks = bookmarks }
+}
@@ -0,0 +1,27 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFlagOptions(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(defaultFlagOpts, NewFlagOptions())
+
+	assert.Equal(&FlagOptions{
+		DisableAllFeatures: true,
+		MinimalFeatures:    true,
+		DeviceNaming:       DeviceById,
+		NoMount:            true,
+	}, NewFlagOptions(WithMinimalFeatures(true), WithDeviceNaming(DeviceById), WithNoMount(true), WithReceived(false)))
+
+	// Later options override earlier ones
+	assert.False(NewFlagOptions(WithClones(true), WithClones(false)).Clones)
+
+	// The defaults are copied, not shared
+	NewFlagOptions(WithReceived(false))
+	assert.True(defaultFlagOpts.IncludeReceived)
+}
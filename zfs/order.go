@@ -0,0 +1,115 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"path"
+)
+
+// Lines of zfs get all output sharing a name
+type lineGroup struct {
+	name  string
+	lines [][]byte
+	// Groups that must follow this one: its snapshots and bookmarks, then its
+	// child datasets, each in input order
+	children, datasets []*lineGroup
+}
+
+// Reorders zfs get all output so that each dataset follows its parent, with
+// its snapshots and bookmarks directly after it, as zfs get all itself lists
+// them. Datasets missing from partial input are skipped over. Otherwise input
+// order is kept, so ordered input is returned unchanged but for blank lines.
+// All of the input is read before any of it is returned. JSON input is
+// returned as is, as jsonToTabs orders it.
+func orderGetAll(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if peekJSON(br) {
+		return br, nil
+	}
+
+	var lines [][]byte
+	for {
+		l, err := br.ReadBytes('\n')
+		if len(l) != 0 || err == nil {
+			lines = append(lines, bytes.TrimSuffix(l, []byte{'\n'}))
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	var out [][]byte
+	sep := byte(' ')
+	if len(lines) != 0 && header.Match(bytes.TrimSpace(lines[0])) {
+		out = append(out, lines[0])
+		lines = lines[1:]
+	} else if len(lines) != 0 && isTabSeparated(lines[0]) {
+		sep = '\t'
+	}
+
+	var groups []*lineGroup
+	index := map[string]*lineGroup{}
+	for _, l := range lines {
+		trimmed := bytes.TrimSpace(l)
+		if len(trimmed) == 0 {
+			continue
+		}
+		field := trimmed
+		if sep == '\t' {
+			field = l
+		}
+		if i := bytes.IndexByte(field, sep); i >= 0 {
+			field = field[:i]
+		}
+		name := string(field)
+
+		g, ok := index[name]
+		if !ok {
+			g = &lineGroup{name: name}
+			index[name] = g
+			groups = append(groups, g)
+		}
+		g.lines = append(g.lines, l)
+	}
+
+	var roots []*lineGroup
+	for _, g := range groups {
+		if dataset := snapshotDataset(g.name); dataset != g.name {
+			if parent, ok := index[dataset]; ok {
+				parent.children = append(parent.children, g)
+				continue
+			}
+		} else if !isRootDataset(g.name) {
+			if parent := nearestGroup(index, g.name); parent != nil {
+				parent.datasets = append(parent.datasets, g)
+				continue
+			}
+		}
+		roots = append(roots, g)
+	}
+
+	var emit func(gs []*lineGroup)
+	emit = func(gs []*lineGroup) {
+		for _, g := range gs {
+			out = append(out, g.lines...)
+			emit(g.children)
+			emit(g.datasets)
+		}
+	}
+	emit(roots)
+	return bytes.NewReader(bytes.Join(out, []byte{'\n'})), nil
+}
+
+// Returns the group of the nearest ancestor of name, or nil if there is none
+func nearestGroup(index map[string]*lineGroup, name string) *lineGroup {
+	for !isRootDataset(name) {
+		name = path.Dir(name)
+		if g, ok := index[name]; ok {
+			return g
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package zfs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PermissionScope is the section of zfs allow output a grant appears in
+type PermissionScope int
+
+const (
+	PermissionLocalDescendent PermissionScope = iota
+	PermissionLocal
+	PermissionDescendent
+)
+
+// Permission is a grant to a user, group, or everyone
+type Permission struct {
+	Scope PermissionScope
+	// user, group, or everyone
+	Kind string
+	// Empty for everyone
+	Who string
+	// Permission names and @sets
+	Perms []string
+}
+
+type PermissionSet struct {
+	Name  string
+	Perms []string
+}
+
+// Permissions are the delegations made on a dataset itself, excluding those
+// it inherits from ancestors
+type Permissions struct {
+	// In zfs allow order
+	Sets []*PermissionSet
+	// Granted to the creator of descendent datasets
+	Create []string
+	// In zfs allow order
+	Entries []*Permission
+}
+
+func zfsAllowRaw(r CommandRunner, dataset string) ([]byte, error) {
+	return r.Run(`zfs`, `allow`, dataset)
+}
+
+// Dataset names may contain spaces
+var allowHeader = regexp.MustCompile(`^---- Permissions on (.+?) -*$`)
+
+var allowScopes = map[string]PermissionScope{
+	"Local+Descendent permissions:": PermissionLocalDescendent,
+	"Local permissions:":            PermissionLocal,
+	"Descendent permissions:":       PermissionDescendent,
+}
+
+// Parses the permissions on dataset from zfs allow output, or nil if none
+func parseAllow(dataset string, b []byte) (*Permissions, error) {
+	perms := &Permissions{}
+	inDataset := false
+	section := ""
+	for _, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		if m := allowHeader.FindStringSubmatch(l); m != nil {
+			inDataset = m[1] == dataset
+			section = ""
+			continue
+		}
+		if !inDataset {
+			continue
+		}
+
+		if strings.HasSuffix(l, ":") {
+			section = l
+			continue
+		}
+
+		fields := strings.Fields(l)
+		switch scope, ok := allowScopes[section]; {
+		case section == "Permission sets:" && len(fields) == 2 && strings.HasPrefix(fields[0], "@"):
+			perms.Sets = append(perms.Sets, &PermissionSet{Name: fields[0], Perms: strings.Split(fields[1], ",")})
+		case section == "Create time permissions:" && len(fields) == 1:
+			perms.Create = append(perms.Create, strings.Split(fields[0], ",")...)
+		case ok && len(fields) == 3 && (fields[0] == "user" || fields[0] == "group"):
+			perms.Entries = append(perms.Entries, &Permission{Scope: scope, Kind: fields[0], Who: fields[1], Perms: strings.Split(fields[2], ",")})
+		case ok && len(fields) == 2 && fields[0] == "everyone":
+			perms.Entries = append(perms.Entries, &Permission{Scope: scope, Kind: fields[0], Perms: strings.Split(fields[1], ",")})
+		default:
+			return nil, fmt.Errorf("unparseable permission: %s", l)
+		}
+	}
+
+	if len(perms.Sets) == 0 && len(perms.Create) == 0 && len(perms.Entries) == 0 {
+		return nil, nil
+	}
+	return perms, nil
+}
+
+var permissionKinds = map[string]string{
+	"user":     "-u",
+	"group":    "-g",
+	"everyone": "-e",
+}
+
+var permissionScopes = map[PermissionScope]string{
+	PermissionLocal:      "-l",
+	PermissionDescendent: "-d",
+}
+
+// Returns the zfs allow commands recreating the delegations on a dataset, with
+// permission sets first so that later grants may refer to them
+func (p *Pool) CreateAllowCommands(name string) (cmdlines [][]string, err error) {
+	set, ok := p.Datasets.Index[name]
+	if !ok {
+		return nil, fmt.Errorf("dataset %s not found in pool %s", name, p.Name)
+	}
+	if set.Permissions == nil {
+		return nil, nil
+	}
+
+	for _, s := range set.Permissions.Sets {
+		cmdlines = append(cmdlines, []string{"zfs", "allow", "-s", s.Name, strings.Join(s.Perms, ","), name})
+	}
+	if len(set.Permissions.Create) != 0 {
+		cmdlines = append(cmdlines, []string{"zfs", "allow", "-c", strings.Join(set.Permissions.Create, ","), name})
+	}
+	for _, e := range set.Permissions.Entries {
+		cmdline := []string{"zfs", "allow"}
+		if flag, ok := permissionScopes[e.Scope]; ok {
+			cmdline = append(cmdline, flag)
+		}
+		cmdline = append(cmdline, permissionKinds[e.Kind])
+		if e.Who != "" {
+			cmdline = append(cmdline, e.Who)
+		}
+		cmdlines = append(cmdlines, append(cmdline, strings.Join(e.Perms, ","), name))
+	}
+	return cmdlines, nil
+}
@@ -0,0 +1,88 @@
+package zfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissions(t *testing.T) {
+	assert := require.New(t)
+
+	runner := fakeRunner{
+		"zpool get all": `NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    0      default
+`,
+		"zfs get all": `NAME        PROPERTY  VALUE       SOURCE
+tank        type      filesystem  -
+tank/home   type      filesystem  -
+tank/users  type      filesystem  -
+`,
+		"zfs allow tank": ``,
+		"zfs allow tank/home": `---- Permissions on tank/home ----------------------------------------
+Local+Descendent permissions:
+	user cindys create,destroy,mount,snapshot
+`,
+		"zfs allow tank/users": `---- Permissions on tank/users ---------------------------------------
+Permission sets:
+	@pset create,destroy,mount,snapshot
+Create time permissions:
+	destroy
+Local permissions:
+	group staff @pset
+Descendent permissions:
+	everyone mount
+---- Permissions on tank ---------------------------------------------
+Local+Descendent permissions:
+	user root send
+`,
+	}
+
+	in := RunnerInput(runner)
+	in.ZpoolStatus = nil
+	in.ZfsAllow = AllowRunner(runner)
+	pools, err := ImportedPoolsFrom(in)
+	assert.NoError(err)
+
+	pool := pools["tank"]
+	assert.Nil(pool.Datasets.Index["tank"].Permissions)
+	assert.Equal(&Permissions{
+		Sets:    []*PermissionSet{{Name: "@pset", Perms: []string{"create", "destroy", "mount", "snapshot"}}},
+		Create:  []string{"destroy"},
+		Entries: []*Permission{{Scope: PermissionLocal, Kind: "group", Who: "staff", Perms: []string{"@pset"}}, {Scope: PermissionDescendent, Kind: "everyone", Perms: []string{"mount"}}},
+	}, pool.Datasets.Index["tank/users"].Permissions)
+
+	expected := map[string][]string{
+		"tank": nil,
+		"tank/home": {
+			"zfs allow -u cindys create,destroy,mount,snapshot tank/home",
+		},
+		"tank/users": {
+			"zfs allow -s @pset create,destroy,mount,snapshot tank/users",
+			"zfs allow -c destroy tank/users",
+			"zfs allow -l -g staff @pset tank/users",
+			"zfs allow -d -e mount tank/users",
+		},
+	}
+	for name, out := range expected {
+		cmdlines, err := pool.CreateAllowCommands(name)
+		assert.NoError(err)
+		var actual []string
+		for _, cmdline := range cmdlines {
+			actual = append(actual, strings.Join(cmdline, " "))
+		}
+		assert.Equal(out, actual, name)
+	}
+
+	perms, err := parseAllow("tank/my data", []byte("---- Permissions on tank/my data ----\nLocal permissions:\n\tuser root send\n"))
+	assert.NoError(err)
+	assert.Len(perms.Entries, 1)
+
+	_, err = parseAllow("tank", []byte("---- Permissions on tank ----\nLocal permissions:\n\tuser\n"))
+	assert.EqualError(err, "unparseable permission: user")
+
+	runner["zfs allow tank"] = "---- Permissions on tank ----\nBogus:\n\tuser root send\n"
+	_, err = ImportedPoolsFrom(in)
+	assert.EqualError(err, "error parsing zfs allow tank: unparseable permission: user root send")
+}
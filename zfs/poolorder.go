@@ -0,0 +1,129 @@
+package zfs
+
+import (
+	"sort"
+	"strings"
+)
+
+// OrderPools returns the names of pools in the order their commands should
+// be run: a pool with a dataset mounted beneath a mountpoint of another pool
+// follows that pool, so that its mountpoint isn't hidden when the other is
+// mounted. Otherwise pools are in alphabetical order. Leaf devices shared by
+// more than one pool are warned about, since only one of them can be created.
+func OrderPools(pools map[string]*Pool) []string {
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	warnSharedDevices(pools, names)
+
+	// Pools each pool must follow
+	after := make(map[string]map[string]bool, len(names))
+	for _, name := range names {
+		after[name] = make(map[string]bool)
+	}
+	for _, a := range names {
+		for _, b := range names {
+			if a != b && mountedBeneath(pools[b], pools[a]) {
+				after[b][a] = true
+			}
+		}
+	}
+
+	ordered := make([]string, 0, len(names))
+	done := make(map[string]bool, len(names))
+	for len(ordered) < len(names) {
+		next := ""
+		for _, name := range names {
+			if !done[name] && allDone(after[name], done) {
+				next = name
+				break
+			}
+		}
+		if next == "" {
+			// Pools mounted beneath each other, so any order hides a mountpoint
+			var rest []string
+			for _, name := range names {
+				if !done[name] {
+					rest = append(rest, name)
+				}
+			}
+			Warnf("pools %s are mounted beneath each other; they will be created in alphabetical order", strings.Join(rest, ", "))
+			return append(ordered, rest...)
+		}
+		ordered = append(ordered, next)
+		done[next] = true
+	}
+	return ordered
+}
+
+func allDone(names map[string]bool, done map[string]bool) bool {
+	for name := range names {
+		if !done[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the mountpoints of the datasets of p that are mounted by zfs. The
+// value listed for an inherited mountpoint is the dataset's own path.
+func mountpoints(p *Pool) (paths []string) {
+	for _, d := range p.Datasets.Ordered {
+		mp, ok := d.Properties["mountpoint"]
+		if !ok || !strings.HasPrefix(mp.localValue, "/") {
+			continue
+		}
+		paths = append(paths, mp.localValue)
+	}
+	return paths
+}
+
+// Reports whether a dataset of p is mounted strictly beneath a mountpoint of other
+func mountedBeneath(p, other *Pool) bool {
+	for _, path := range mountpoints(p) {
+		for _, parent := range mountpoints(other) {
+			if path != parent && (parent == "/" || strings.HasPrefix(path, parent+"/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Warns about leaf devices in more than one pool, other than hot spares,
+// which pools may share
+func warnSharedDevices(pools map[string]*Pool, names []string) {
+	owners := make(map[string][]string)
+	var devices []string
+	for _, name := range names {
+		v := pools[name].Vdevs
+		if v == nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, groups := range [][]*VdevGroup{v.Data, v.Special, v.Dedup, v.Log, v.Cache} {
+			for _, g := range groups {
+				for _, dev := range g.Children {
+					if seen[dev] {
+						continue
+					}
+					seen[dev] = true
+					if len(owners[dev]) == 0 {
+						devices = append(devices, dev)
+					}
+					owners[dev] = append(owners[dev], name)
+				}
+			}
+		}
+	}
+
+	sort.Strings(devices)
+	for _, dev := range devices {
+		if len(owners[dev]) > 1 {
+			Warnf("device %s is used by pools %s; only one of them can be created", dev, strings.Join(owners[dev], ", "))
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package zfs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderPools(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	zpoolInput := []byte(`NAME   PROPERTY               VALUE    SOURCE
+apool  feature@async_destroy  enabled  local
+tank   feature@async_destroy  enabled  local
+zpool  feature@async_destroy  enabled  local`)
+
+	pools, err := ParseProperties([]byte(`NAME        PROPERTY    VALUE          SOURCE
+apool       type        filesystem     -
+apool       mountpoint  none           local
+apool/data  type        filesystem     -
+apool/data  mountpoint  /tank/data     local
+tank        type        filesystem     -
+tank        mountpoint  /tank          default
+tank/home   type        filesystem     -
+tank/home   mountpoint  /tank/home     inherited from tank
+zpool       type        filesystem     -
+zpool       mountpoint  /zpool         default`), zpoolInput)
+	assert.NoError(err)
+	assert.Equal([]string{"tank", "apool", "zpool"}, OrderPools(pools))
+	assert.Empty(warnings)
+
+	pools["tank"].Vdevs = &Vdevs{Data: []*VdevGroup{{Kind: "mirror", Children: []string{"/dev/sda", "/dev/sdb"}}}, Spare: []*VdevGroup{{Children: []string{"/dev/sdz"}}}}
+	pools["apool"].Vdevs = &Vdevs{Data: []*VdevGroup{{Children: []string{"/dev/sdc"}}}, Cache: []*VdevGroup{{Children: []string{"/dev/sdb"}}}, Spare: []*VdevGroup{{Children: []string{"/dev/sdz"}}}}
+	assert.Equal([]string{"tank", "apool", "zpool"}, OrderPools(pools))
+	assert.Equal([]string{"device /dev/sdb is used by pools apool, tank; only one of them can be created"}, warnings)
+
+	warnings = nil
+	pools, err = ParseProperties([]byte(`NAME        PROPERTY    VALUE          SOURCE
+apool       type        filesystem     -
+apool       mountpoint  /apool         default
+apool/data  type        filesystem     -
+apool/data  mountpoint  /tank/data     local
+tank        type        filesystem     -
+tank        mountpoint  /tank          default
+tank/a      type        filesystem     -
+tank/a      mountpoint  /apool/a       local
+zpool       type        filesystem     -
+zpool       mountpoint  /zpool         default`), zpoolInput)
+	assert.NoError(err)
+	assert.Equal([]string{"zpool", "apool", "tank"}, OrderPools(pools))
+	assert.Equal([]string{"pools apool, tank are mounted beneath each other; they will be created in alphabetical order"}, warnings)
+}
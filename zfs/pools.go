@@ -0,0 +1,1695 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/josephvusich/zinfer/zfs/zfscli"
+	"golang.org/x/sync/errgroup"
+)
+
+type PropertyLocation int
+
+const (
+	PropertyDefault PropertyLocation = iota
+	PropertyLocal
+	PropertyInherited
+	PropertyReadonly
+	PropertyReceived
+	PropertyTemporary
+)
+
+const (
+	FeatureDisabled = "disabled"
+	FeatureEnabled  = "enabled"
+	FeatureActive   = "active"
+)
+
+type PropertySource struct {
+	Location PropertyLocation
+	Parent   string
+	// nil if Parent is missing from partial input
+	Inherited *Property
+
+	// Reported with source -, so inherited only at creation
+	readonly bool
+}
+
+type Property struct {
+	Name       string
+	localValue string
+	Source     PropertySource
+}
+
+func (p *Property) Value() string {
+	if p.Source.Location == PropertyInherited && p.Source.Inherited != nil {
+		return p.Source.Inherited.Value()
+	}
+	return p.localValue
+}
+
+func isParent(self, parent string) bool {
+	return strings.HasPrefix(self, fmt.Sprintf("%s/", parent))
+}
+
+func (p *Property) statusOnly() bool {
+	if p.Source.Location == PropertyTemporary {
+		return true
+	}
+	if _, ok := statusProperties[p.Name]; ok {
+		return true
+	}
+	_, ok := ignoreProperties[p.Name]
+	return ok
+}
+
+func (p *Property) nonEncryptionInherit() bool {
+	_, ok := encryptionInheritedProperties[p.Name]
+	return !ok && !p.statusOnly()
+}
+
+func (p *Property) isEncryption() bool {
+	_, ok := encryptionInheritedProperties[p.Name]
+	return ok
+}
+
+// Reports whether an encrypted child's key property was set by zfs change-key
+// rather than inherited from root. Children normally report keylocation=none.
+func (p *Property) changedKey(root *Property) bool {
+	if _, ok := encryptionKeyProperties[p.Name]; !ok || p.Value() == root.Value() {
+		return false
+	}
+	return p.Source.Location != PropertyDefault && !(p.Name == "keylocation" && p.Value() == "none")
+}
+
+// Reports whether the property has its default value even if set locally
+func (p *Property) hasDefaultValue() bool {
+	value, ok := defaultValues[p.Name]
+	return ok && p.localValue == value
+}
+
+// NonDefault reports whether the property deviates from its zfs default: it
+// is settable or sets up encryption, not from the default source, and not set
+// to its default value. Inherited properties deviate as much as the ancestor
+// they are inherited from.
+func (p *Property) NonDefault() bool {
+	if p.statusOnly() || (p.Source.Location == PropertyReadonly && !p.isEncryption()) {
+		return false
+	}
+	return p.Source.Location != PropertyDefault && !p.hasDefaultValue()
+}
+
+// NonDefaultProperties returns the properties of d that deviate from their
+// defaults, sorted by name
+func (d *Dataset) NonDefaultProperties() (props []*Property) {
+	d.WalkProperties(func(p *Property) error {
+		if p.NonDefault() {
+			props = append(props, p)
+		}
+		return nil
+	})
+	return props
+}
+
+// User properties are named module:property, such as com.example:backup
+func (p *Property) isUser() bool {
+	return strings.Contains(p.Name, ":")
+}
+
+func (p *Property) isFeature() bool {
+	return strings.HasPrefix(p.Name, "feature@")
+}
+
+// Returns why the property is left out of creation flags, or "" if it isn't
+func (p *Property) omitReason(opts *FlagOptions) string {
+	switch {
+	case p.statusOnly():
+		return "status-only"
+	case p.Source.Location == PropertyDefault:
+		return "default source"
+	case p.hasDefaultValue():
+		return "default value"
+	case p.Source.Location == PropertyInherited && p.Source.Inherited != nil:
+		return fmt.Sprintf("inherited from %s", p.Source.Parent)
+	case p.Source.Location == PropertyReceived && !opts.IncludeReceived:
+		return "received"
+	case p.isFeature() && p.localValue == FeatureDisabled && opts.DisableAllFeatures:
+		return "disabled feature"
+	case p.isFeature() && opts.MinimalFeatures && p.localValue == FeatureEnabled:
+		return "minimal-feature"
+	case len(opts.IncludeProperties) != 0 && !contains(opts.IncludeProperties, p.Name):
+		return "not included"
+	case contains(opts.ExcludeProperties, p.Name):
+		return "excluded"
+	case opts.OnlyLocal && p.Source.Location != PropertyLocal && !p.isEncryption():
+		return "not local"
+	case opts.NoUserProperties && p.isUser():
+		return "user property"
+	case opts.NoShares && (p.Name == "sharenfs" || p.Name == "sharesmb"):
+		return "share"
+	}
+	return ""
+}
+
+// owner is the pool or dataset the property belongs to, for omitf
+func (p *Property) flag(owner, o string, opts *FlagOptions, omitf func(string, ...interface{})) []string {
+	if reason := p.omitReason(opts); reason != "" {
+		omitf("%s: omitting %s (%s)", owner, p.Name, reason)
+		return nil
+	}
+	value := p.localValue
+	if p.isFeature() && value == FeatureActive {
+		value = FeatureEnabled
+	}
+	if p.Name == "keylocation" {
+		value = opts.keyLocation(owner, value)
+	}
+	return []string{fmt.Sprintf("-%s", o), fmt.Sprintf("%s=%s", p.Name, value)}
+}
+
+type Dataset struct {
+	Name       string
+	Properties map[string]*Property
+	// Ordered by creation
+	Snapshots []*Snapshot
+	// In input order
+	Bookmarks []*Bookmark
+	// Delegated with zfs allow, or nil if none or not captured
+	Permissions *Permissions
+	// Encryption root that is not an ancestor, as with a clone of an
+	// encrypted dataset, or "" if there is none
+	ExternalEncryptionRoot string
+}
+
+func (d *Dataset) isVolume() bool {
+	prop, ok := d.Properties["type"]
+	return ok && prop.Value() == "volume"
+}
+
+func isRootDataset(name string) bool {
+	return !strings.ContainsRune(name, '/')
+}
+
+type sortedProperties []*Property
+
+func (s sortedProperties) Len() int {
+	return len(s)
+}
+
+func (s sortedProperties) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
+
+func (s sortedProperties) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (d *Dataset) flags(o string, opts *FlagOptions) []string {
+	return d.flagsWith(o, opts, Omitf)
+}
+
+func (d *Dataset) flagsWith(o string, opts *FlagOptions, omitf func(string, ...interface{})) (flags []string) {
+	var encryptedChild bool
+	if er, ok := d.Properties[encryptionRoot]; ok && er.Value() != d.Name {
+		encryptedChild = true
+	}
+	// Only passphrases are stretched with PBKDF2, zfs create rejects
+	// pbkdf2iters for raw and hex keys
+	var rawKey bool
+	if kf, ok := d.Properties["keyformat"]; ok && (kf.Value() == "raw" || kf.Value() == "hex") {
+		rawKey = true
+	}
+
+	d.WalkProperties(func(p *Property) error {
+		if _, ok := volumeProperties[p.Name]; ok && d.isVolume() {
+			return nil
+		}
+		if rawKey && p.Name == "pbkdf2iters" {
+			omitf("%s: omitting %s (keyformat=%s)", d.Name, p.Name, d.Properties["keyformat"].Value())
+			return nil
+		}
+		if encryptedChild {
+			if _, ok := encryptionInheritedProperties[p.Name]; ok {
+				if _, ok := encryptionLocalProperties[p.Name]; !ok || d.ExternalEncryptionRoot != "" {
+					omitf("%s: omitting %s (encryption-inherited)", d.Name, p.Name)
+					return nil
+				}
+			}
+		}
+		flags = append(flags, p.flag(d.Name, o, opts, omitf)...)
+		return nil
+	})
+
+	return flags
+}
+
+type Pool struct {
+	Name       string
+	Properties map[string]*Property
+	Vdevs      *Vdevs
+	Datasets   struct {
+		// Zero index is always the root dataset
+		Ordered []*Dataset
+		Index   map[string]*Dataset
+	}
+}
+
+func (p *Pool) flags(opts *FlagOptions) (flags []string) {
+	var sorted sortedProperties
+	for _, p := range p.Properties {
+		sorted = append(sorted, p)
+	}
+	sort.Sort(sorted)
+	orderFeatures(sorted)
+
+	// zpool import -R sets altroot and implies cachefile=none
+	altroot, ok := p.Properties["altroot"]
+	imported := ok && altroot.Source.Location == PropertyLocal
+	for _, prop := range sorted {
+		switch {
+		case prop.Name == "altroot" && !opts.IncludeAltroot:
+			Omitf("%s: omitting altroot (transient import property)", p.Name)
+			continue
+		case prop.Name == "cachefile" && imported && prop.Value() == "none":
+			Omitf("%s: omitting cachefile (implied by altroot)", p.Name)
+			continue
+		case prop.Name == "bootfs":
+			// Set by SetBootfsCommand once the dataset exists
+			continue
+		case isPostCreate(prop.Name):
+			// Omissions are explained by SetPropertyCommands
+			if prop.omitReason(opts) != "" {
+				continue
+			}
+			if prop.Name == "multihost" {
+				Omitf("%s: deferring multihost to zpool set (depends on the hostid, see zgenhostid)", p.Name)
+			} else {
+				Omitf("%s: deferring %s to zpool set", p.Name, prop.Name)
+			}
+			continue
+		}
+		flags = append(flags, prop.flag(p.Name, "o", opts, Omitf)...)
+	}
+
+	return flags
+}
+
+// Returns the features emitted by CreatePoolCommand that are active rather
+// than merely enabled, in alphabetical order
+func (p *Pool) ActiveFeatures(opts *FlagOptions) (active []string) {
+	for _, prop := range propertyList(p.Properties) {
+		if prop.isFeature() && prop.localValue == FeatureActive && prop.omitReason(opts) == "" {
+			active = append(active, prop.Name)
+		}
+	}
+	return active
+}
+
+func isPostCreate(name string) bool {
+	_, ok := postCreateProperties[name]
+	return ok
+}
+
+// Returns a zpool set for each pool property that CreatePoolCommand leaves to
+// be set once the pool exists, see postCreateProperties
+func (p *Pool) SetPropertyCommands(opts *FlagOptions) (cmdlines [][]string) {
+	if opts == nil {
+		opts = defaultFlagOpts
+	}
+	for _, prop := range propertyList(p.Properties) {
+		if !isPostCreate(prop.Name) {
+			continue
+		}
+		flag := prop.flag(p.Name, "o", opts, Omitf)
+		if flag == nil {
+			continue
+		}
+		if prop.Name == "multihost" && prop.Value() == "on" {
+			Warnf("%s has multihost=on; /etc/hostid must match the hostid of the host that imported it, and be unique among hosts sharing its devices", p.Name)
+		}
+		cmdlines = append(cmdlines, []string{"zpool", "set", flag[1], p.Name})
+	}
+	return cmdlines
+}
+
+// Reorders the features among sorted properties so that each follows the
+// features it depends on, see featureDependencies. Features are otherwise
+// kept in alphabetical order.
+func orderFeatures(sorted sortedProperties) {
+	var features sortedProperties
+	index := map[string]*Property{}
+	for _, prop := range sorted {
+		if prop.isFeature() {
+			features = append(features, prop)
+			index[strings.TrimPrefix(prop.Name, "feature@")] = prop
+		}
+	}
+
+	ordered := make(sortedProperties, 0, len(features))
+	visited := map[*Property]bool{}
+	var visit func(prop *Property)
+	visit = func(prop *Property) {
+		if visited[prop] {
+			return
+		}
+		visited[prop] = true
+		for _, dep := range featureDependencies[strings.TrimPrefix(prop.Name, "feature@")] {
+			if d, ok := index[dep]; ok {
+				visit(d)
+			}
+		}
+		ordered = append(ordered, prop)
+	}
+	for _, prop := range features {
+		visit(prop)
+	}
+
+	// Features take the positions they held in alphabetical order
+	i := 0
+	for j, prop := range sorted {
+		if prop.isFeature() {
+			sorted[j] = ordered[i]
+			i++
+		}
+	}
+}
+
+func (p *Pool) addDataset(d *Dataset) error {
+	if _, ok := p.Datasets.Index[d.Name]; ok {
+		return &DuplicateDatasetError{Pool: p.Name, Name: d.Name}
+	}
+	p.Datasets.Ordered = append(p.Datasets.Ordered, d)
+	p.Datasets.Index[d.Name] = d
+	return nil
+}
+
+// Resolves the ancestors of datasets in a pool, memoizing parents and the
+// nearest ancestor holding each property so that no part of the tree is
+// walked twice
+type ancestry struct {
+	pool *Pool
+	// Skip ancestors missing from partial input
+	skipMissing bool
+	// Skip missing ancestors with a warning rather than failing
+	warnMissing bool
+	// Missing ancestors already warned about
+	missing map[string]bool
+
+	// Nearest ancestor in the input, or nil for the root
+	parents map[*Dataset]*Dataset
+	nearest map[ancestryKey]*Dataset
+}
+
+type ancestryKey struct {
+	set  *Dataset
+	prop string
+}
+
+func newAncestry(pool *Pool, skipMissing, warnMissing bool) *ancestry {
+	return &ancestry{
+		pool:        pool,
+		skipMissing: skipMissing,
+		warnMissing: warnMissing,
+		missing:     make(map[string]bool),
+		parents:     make(map[*Dataset]*Dataset),
+		nearest:     make(map[ancestryKey]*Dataset),
+	}
+}
+
+func (a *ancestry) parent(d *Dataset) (*Dataset, error) {
+	if parent, ok := a.parents[d]; ok {
+		return parent, nil
+	}
+
+	var parent *Dataset
+	for name := d.Name; !isRootDataset(name); {
+		name = path.Dir(name)
+		if set, ok := a.pool.Datasets.Index[name]; ok {
+			parent = set
+			break
+		}
+		if a.skipMissing || a.missing[name] {
+			continue
+		}
+		err := fmt.Errorf("%s descends from %s, %s", d.Name, name, missingFromInput)
+		if !a.warnMissing {
+			return nil, err
+		}
+		Warnf("%v; skipping it", err)
+		a.missing[name] = true
+	}
+	a.parents[d] = parent
+	return parent, nil
+}
+
+// Returns the nearest ancestor of d with the property, or nil if there is none
+func (a *ancestry) withProperty(d *Dataset, prop string) (*Dataset, error) {
+	key := ancestryKey{d, prop}
+	if set, ok := a.nearest[key]; ok {
+		return set, nil
+	}
+
+	parent, err := a.parent(d)
+	if err != nil || parent == nil {
+		return nil, err
+	}
+	set := parent
+	if _, ok := parent.Properties[prop]; !ok {
+		if set, err = a.withProperty(parent, prop); err != nil {
+			return nil, err
+		}
+	}
+	a.nearest[key] = set
+	return set, nil
+}
+
+type FlagOptions struct {
+	// Create the pool with zpool create -d, so that only the features emitted
+	// as enabled are enabled. Otherwise zpool create enables every feature,
+	// and the disabled ones are emitted as disabled.
+	DisableAllFeatures bool
+	// Omit pool features that are "enabled" but not "active". Without
+	// DisableAllFeatures they are still enabled by zpool create.
+	MinimalFeatures bool
+	// Note the features that are active, not merely enabled, in the Comment
+	// of the pool's Command. They are still emitted as enabled.
+	PreserveActive bool
+	// Note the source of each property in the Notes of the pool's and each
+	// dataset's Command
+	AnnotateProperties bool
+
+	// Namespace used for leaf device paths
+	DeviceNaming DeviceNaming
+
+	// Emit zfs clone for datasets with an origin, which must also be recreated
+	Clones bool
+
+	// Pass -u to zfs create so recreated filesystems are not mounted. zpool
+	// create has no equivalent, so the root dataset of each pool still is.
+	NoMount bool
+
+	// Emit the altroot the pool is currently imported with
+	IncludeAltroot bool
+
+	// Emit properties set by zfs receive as if they were local. This is the
+	// default when FlagOptions is nil.
+	IncludeReceived bool
+
+	// Pass -p to zfs create and zfs clone so missing ancestors are created.
+	// Ancestors created this way only get inherited and default properties,
+	// so any dataset with properties of its own must still be created first.
+	CreateParents bool
+
+	// Follow each dataset with zfs inherit for its inherited properties, see
+	// CreateInheritCommands
+	ExplicitInherit bool
+
+	// If not empty, only these properties are emitted, leaving all others
+	// at their defaults. Pool features count as properties, as do user
+	// properties. Names matching no property are ignored.
+	IncludeProperties []string
+	// These properties are never emitted, even if in IncludeProperties
+	ExcludeProperties []string
+
+	// Only emit locally set properties, leaving out received and creation-time
+	// properties. Temporary properties are always left out. The encryption
+	// properties of an encryption root are kept, as zfs create can't set
+	// keylocation without them.
+	OnlyLocal bool
+
+	// Omit user properties, for those who manage them separately
+	NoUserProperties bool
+	// Omit sharenfs and sharesmb, for those who manage exports separately
+	NoShares bool
+
+	// Replacement keylocation URIs, such as file:///root/key, by encryption
+	// root. The one keyed by "" replaces keylocation=prompt on every other
+	// encryption root, so that zfs create doesn't wait for a passphrase.
+	KeyLocations map[string]string
+
+	// Follow the zpool import of ImportCommands with zfs load-key of each
+	// encryption root
+	LoadKeys bool
+
+	// Recreate snapshots after their dataset, in order of creation
+	Snapshots bool
+	// Recreate user holds and bookmarks; requires Snapshots
+	Holds     bool
+	Bookmarks bool
+}
+
+var defaultFlagOpts = &FlagOptions{DisableAllFeatures: true, IncludeReceived: true}
+
+// Returns the keylocation to emit for the encryption root name
+func (o *FlagOptions) keyLocation(name, value string) string {
+	if loc, ok := o.KeyLocations[name]; ok {
+		return loc
+	}
+	if loc, ok := o.KeyLocations[""]; ok && value == "prompt" {
+		return loc
+	}
+	return value
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Pool) CreatePoolCommand(opts *FlagOptions) (cmdline []string, err error) {
+	if opts == nil {
+		opts = defaultFlagOpts
+	}
+
+	root, ok := p.Datasets.Index[p.Name]
+	if !ok {
+		return nil, fmt.Errorf("missing root dataset: %s", p.Name)
+	}
+	p.checkSpecialSmallBlocks(root, opts)
+	p.checkLogDevice(root, opts)
+	p.checkReadonly(root)
+
+	cmdline = []string{"zpool", "create"}
+	if opts.DisableAllFeatures {
+		cmdline = append(cmdline, "-d")
+	}
+	if prop, ok := p.Properties["ashift"]; !ok || prop.Source.Location != PropertyLocal {
+		if ashift := p.Vdevs.ashift(p.Name); ashift != 0 {
+			cmdline = append(cmdline, "-o", fmt.Sprintf("ashift=%d", ashift))
+		}
+	}
+	cmdline = append(cmdline, p.flags(opts)...)
+	cmdline = append(cmdline, root.flags("O", opts)...)
+	cmdline = append(cmdline, p.Name)
+	cmdline = append(cmdline, p.Vdevs.args(opts)...)
+	return cmdline, nil
+}
+
+// readonly is never emitted, see ignoreProperties, so warns that a readonly
+// dataset will be created read-write. Its readonly descendants are not warned
+// about separately.
+func (p *Pool) checkReadonly(set *Dataset) {
+	prop, ok := set.Properties["readonly"]
+	if !ok || prop.Value() != "on" || prop.Source.Inherited != nil {
+		return
+	}
+	if parent, ok := p.Datasets.Index[path.Dir(set.Name)]; ok {
+		if ro, ok := parent.Properties["readonly"]; ok && ro.Value() == "on" {
+			return
+		}
+	}
+	Warnf("%s has readonly=on (%s), which is not reproduced; it will be created read-write", set.Name, prop.Source)
+}
+
+// Returns the dataset the pool boots from, or "" if bootfs is not set
+func (p *Pool) Bootfs() string {
+	if prop, ok := p.Properties["bootfs"]; ok && prop.Source.Location == PropertyLocal {
+		return prop.Value()
+	}
+	return ""
+}
+
+// bootfs references a dataset, so it can only be set after that dataset is created
+func (p *Pool) SetBootfsCommand() (cmdline []string, err error) {
+	bootfs := p.Bootfs()
+	if bootfs == "" {
+		return nil, fmt.Errorf("bootfs is not set on pool %s", p.Name)
+	}
+	return []string{"zpool", "set", fmt.Sprintf("bootfs=%s", bootfs), p.Name}, nil
+}
+
+// IsEncryptionRoot reports whether d holds the key of its encryption, rather
+// than inheriting it
+func (d *Dataset) IsEncryptionRoot() bool {
+	er, ok := d.Properties[encryptionRoot]
+	return ok && er.Value() == d.Name
+}
+
+// Returns the zfs load-key command for the encryption root name
+func (p *Pool) LoadKeyCommand(name string) (cmdline []string, err error) {
+	set, ok := p.Datasets.Index[name]
+	if !ok {
+		return nil, fmt.Errorf("dataset %s not found in pool %s", name, p.Name)
+	}
+	if !set.IsEncryptionRoot() {
+		return nil, fmt.Errorf("%s is not an encryption root", name)
+	}
+	return []string{"zfs", "load-key", name}, nil
+}
+
+// Returns the zfs change-key command giving an encrypted child the keyformat
+// and keylocation that differ from its encryption root, or nil if there are
+// none. These can't be passed to zfs create without making the child an
+// encryption root of its own.
+func (p *Pool) ChangeKeyCommand(name string) (cmdline []string, err error) {
+	set, ok := p.Datasets.Index[name]
+	if !ok {
+		return nil, fmt.Errorf("dataset %s not found in pool %s", name, p.Name)
+	}
+	if set.ExternalEncryptionRoot != "" {
+		return nil, nil
+	}
+	rootSet, err := p.encryptionRootOf(set)
+	if err != nil || rootSet == nil {
+		return nil, err
+	}
+
+	var sorted sortedProperties
+	for propName := range encryptionKeyProperties {
+		prop, ok := set.Properties[propName]
+		rootProp, rootOk := rootSet.Properties[propName]
+		if ok && rootOk && prop.changedKey(rootProp) {
+			sorted = append(sorted, prop)
+		}
+	}
+	if len(sorted) == 0 {
+		return nil, nil
+	}
+	sort.Sort(sorted)
+
+	cmdline = []string{"zfs", "change-key"}
+	for _, prop := range sorted {
+		cmdline = append(cmdline, "-o", fmt.Sprintf("%s=%s", prop.Name, prop.Value()))
+	}
+	return append(cmdline, name), nil
+}
+
+// Returns the zpool import command that finds the pool's devices where
+// opts.DeviceNaming names them
+func (p *Pool) ImportPoolCommand(opts *FlagOptions) []string {
+	if opts == nil {
+		opts = defaultFlagOpts
+	}
+
+	cmdline := []string{"zpool", "import"}
+	if dir := opts.DeviceNaming.importDir(); dir != "" {
+		cmdline = append(cmdline, "-d", dir)
+	}
+	return append(cmdline, p.Name)
+}
+
+// Returns a zfs inherit command for each property the dataset inherits, so that
+// it stays inherited even if applied out of order with commands setting it.
+// Properties inherited only at creation or from the encryption root are skipped.
+func (p *Pool) CreateInheritCommands(name string) (cmdlines [][]string, err error) {
+	set, ok := p.Datasets.Index[name]
+	if !ok {
+		return nil, fmt.Errorf("dataset %s not found in pool %s", name, p.Name)
+	}
+
+	set.WalkProperties(func(prop *Property) error {
+		if prop.Source.Location == PropertyInherited && prop.Source.Inherited != nil && !prop.Source.readonly && prop.nonEncryptionInherit() {
+			cmdlines = append(cmdlines, []string{"zfs", "inherit", prop.Name, name})
+		}
+		return nil
+	})
+	return cmdlines, nil
+}
+
+// Implied reports whether zfs create -p of a descendant would create name
+// exactly as CreateDatasetCommand does, so that it may be left out. This
+// requires opts.CreateParents, and that name has no properties to set and
+// nothing else to recreate.
+func (p *Pool) Implied(name string, opts *FlagOptions) bool {
+	if opts == nil || !opts.CreateParents || isRootDataset(name) {
+		return false
+	}
+
+	set, ok := p.Datasets.Index[name]
+	if !ok || set.isVolume() || (opts.Clones && set.origin() != "") || name == p.Bootfs() {
+		return false
+	}
+	if len(set.Snapshots) != 0 || len(set.Bookmarks) != 0 || set.Permissions != nil {
+		return false
+	}
+
+	hasChild := false
+	for _, d := range p.Datasets.Ordered {
+		if isParent(d.Name, name) {
+			hasChild = true
+			break
+		}
+	}
+	return hasChild && len(set.flagsWith("o", opts, func(string, ...interface{}) {})) == 0
+}
+
+func (p *Pool) CreateDatasetCommand(name string, opts *FlagOptions) (cmdline []string, err error) {
+	if opts == nil {
+		opts = defaultFlagOpts
+	}
+
+	set, ok := p.Datasets.Index[name]
+	if !ok {
+		return nil, fmt.Errorf("dataset %s not found in pool %s", name, p.Name)
+	}
+	p.checkSpecialSmallBlocks(set, opts)
+	p.checkLogDevice(set, opts)
+	p.checkReadonly(set)
+
+	if origin := set.origin(); origin != "" && opts.Clones {
+		switch {
+		case p.promotedOrigin(set):
+			Warnf("origin %s of %s belongs to a dataset that must be created after it, as left by zfs promote; the clone will be created as a new dataset", origin, set.Name)
+		case findSnapshot(map[string]*Pool{p.Name: p}, origin) == nil:
+			Warnf("origin %s of %s not found, the clone will be created as a new dataset", origin, set.Name)
+		default:
+			cmdline = []string{"zfs", "clone"}
+			if opts.CreateParents {
+				cmdline = append(cmdline, "-p")
+			}
+			cmdline = append(cmdline, set.flags("o", opts)...)
+			cmdline = append(cmdline, origin, set.Name)
+			return cmdline, nil
+		}
+	}
+	if set.ExternalEncryptionRoot != "" {
+		Warnf("encryptionroot %s of %s is not an ancestor, zfs create can't reproduce its encryption", set.ExternalEncryptionRoot, set.Name)
+	}
+
+	cmdline = []string{"zfs", "create"}
+	if opts.CreateParents {
+		cmdline = append(cmdline, "-p")
+	}
+	if set.isVolume() {
+		volsize, ok := set.Properties["volsize"]
+		if !ok {
+			return nil, fmt.Errorf("volume %s is missing property: volsize", set.Name)
+		}
+		if set.isSparse() {
+			cmdline = append(cmdline, "-s")
+		}
+		cmdline = append(cmdline, "-V", volsize.Value())
+		if b, ok := set.Properties["volblocksize"]; ok {
+			cmdline = append(cmdline, "-b", b.Value())
+		}
+	} else if opts.NoMount {
+		cmdline = append(cmdline, "-u")
+	}
+	cmdline = append(cmdline, set.flags("o", opts)...)
+	cmdline = append(cmdline, set.Name)
+	return cmdline, nil
+}
+
+var (
+	header   = regexp.MustCompile(`^NAME\s+PROPERTY\s+VALUE\s+SOURCE$`)
+	property = regexp.MustCompile(`^([^ ]+) +([^ ]+) +((?U).*) +(-|default|local|temporary|received|inherited from )([^ ]+)?$`)
+)
+
+// Sources other than -, default, local, and temporary, such as inherited
+// from, which pool properties can't be, are taken as local with a warning
+func parseZpoolSource(pool, name string, raw string) (*PropertySource, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "-":
+		return &PropertySource{Location: PropertyReadonly}, nil
+	case "default":
+		return &PropertySource{Location: PropertyDefault}, nil
+	case "local":
+		return &PropertySource{Location: PropertyLocal}, nil
+	case "temporary":
+		return &PropertySource{Location: PropertyTemporary}, nil
+	case "":
+		return nil, fmt.Errorf("property source for %s is missing", name)
+	default:
+		Warnf("%s property %s has unrecognized source %q, treating it as local", pool, name, raw)
+		return &PropertySource{Location: PropertyLocal}, nil
+	}
+}
+
+func parseSource(name string, value string, raw string, parent string, pool *Pool) (PropertySource, error) {
+	if _, ok := statusProperties[name]; ok && raw != "-" {
+		return PropertySource{}, fmt.Errorf("property %s expected to be readonly", name)
+	}
+
+	switch raw {
+	case "-":
+		return PropertySource{Location: PropertyReadonly}, nil
+	case "default":
+		return PropertySource{Location: PropertyDefault}, nil
+	case "local":
+		return PropertySource{Location: PropertyLocal}, nil
+	case "received":
+		return PropertySource{Location: PropertyReceived}, nil
+	case "temporary":
+		return PropertySource{Location: PropertyTemporary}, nil
+	case "inherited from ":
+		if parent, ok := pool.Datasets.Index[parent]; ok {
+			if prop, ok := parent.Properties[name]; ok {
+				if !inheritedMatches(name, value, prop.Value()) {
+					return PropertySource{}, &InheritanceMismatchError{Property: name, Parent: parent.Name, Value: value, ParentValue: prop.Value()}
+				}
+				return PropertySource{
+					Location:  PropertyInherited,
+					Parent:    parent.Name,
+					Inherited: prop,
+				}, nil
+			}
+			return PropertySource{}, fmt.Errorf("parent %s does not contain property %s", parent.Name, name)
+		}
+		return PropertySource{}, unknownParent(parent)
+	}
+
+	return PropertySource{}, fmt.Errorf("property source for %s is invalid: %s", name, raw)
+}
+
+// Mountpoint tokens that are inherited verbatim rather than as a path prefix
+var mountpointTokens = map[string]struct{}{
+	"legacy": {},
+	"none":   {},
+}
+
+// Reports whether value is consistent with inheriting parentValue. Inherited
+// mountpoint paths gain the relative dataset name as a suffix, while legacy
+// and none must match exactly.
+func inheritedMatches(name, value, parentValue string) bool {
+	if name == "mountpoint" {
+		if _, ok := mountpointTokens[parentValue]; ok {
+			return value == parentValue
+		}
+	}
+	return strings.HasPrefix(value, parentValue)
+}
+
+// Reports whether b is -H output, having no header and four tab-separated fields
+func isTabSeparated(b []byte) bool {
+	first := b
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		first = b[:i]
+	}
+	return !header.Match(first) && zfscli.IsTabSeparated(first, 4)
+}
+
+func zfsGetAllRaw(r CommandRunner, flags ...string) (io.ReadCloser, error) {
+	return streamCommand(r, `zfs`, append(append([]string{`get`}, flags...), `all`)...)
+}
+
+func zpoolGetAllRaw(r CommandRunner, flags ...string) ([]byte, error) {
+	return r.Run(`zpool`, append(append([]string{`get`}, flags...), `all`)...)
+}
+
+func zpoolParse(b []byte) (map[string]map[string]*Property, error) {
+	return zpoolParseReader(bytes.NewReader(b))
+}
+
+func zpoolParseReader(r io.Reader) (map[string]map[string]*Property, error) {
+	r, err := jsonReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first line is read ahead to tell -H output from a table
+	br := bufio.NewReader(r)
+	first, err := br.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	r = io.MultiReader(bytes.NewReader(first), br)
+
+	poolProps := make(map[string]map[string]*Property)
+
+	scan := zfscli.ScanTableReader
+	// Row i is on line i+lineOffset, after the header of a table
+	lineOffset := 1
+	if isTabSeparated(bytes.TrimSuffix(first, []byte{'\n'})) {
+		scan = func(r io.Reader, each func(int, []string) error) error {
+			return zfscli.ScanTabsReader(r, []string{"NAME", "PROPERTY", "VALUE", "SOURCE"}, each)
+		}
+		lineOffset = 0
+	}
+
+	poolName := ""
+	if err := scan(r, func(i int, row []string) error {
+		if i == 0 {
+			if !header.MatchString(strings.Join(row, " ")) {
+				return fmt.Errorf("unexpected header: %s", row)
+			}
+			return nil
+		}
+
+		if len(row) == 0 {
+			return nil
+		}
+
+		nextName := row[0]
+		if nextName != poolName {
+			poolName = nextName
+			if _, ok := poolProps[poolName]; ok {
+				return fmt.Errorf("line %d: %w", i+lineOffset, &DuplicatePoolError{Name: poolName})
+			}
+			poolProps[poolName] = make(map[string]*Property)
+		}
+
+		propName := row[1]
+		if strings.HasPrefix(propName, unsupportedFeaturePrefix) {
+			Warnf("%s has %s=%s, a feature this zpool does not support; it will be left out", poolName, propName, row[2])
+			return nil
+		}
+		if _, ok := poolInfoProperties[propName]; ok {
+			Omitf("%s: skipping %s (informational)", poolName, propName)
+			return nil
+		}
+		propSrc, err := parseZpoolSource(poolName, propName, row[3])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+lineOffset, err)
+		}
+		poolProps[poolName][propName] = &Property{
+			Name:       propName,
+			localValue: row[2],
+			Source:     *propSrc,
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return poolProps, nil
+}
+
+// Input supplies the raw output of the commands that pools are inferred from
+type Input struct {
+	// zfs get all, called concurrently with ZpoolGetAll. The output is parsed
+	// as it is read, and closed once parsing completes.
+	ZfsGetAll func() (io.ReadCloser, error)
+	// zpool get all
+	ZpoolGetAll func() ([]byte, error)
+	// zpool status -P; if nil, pools are returned without vdevs
+	ZpoolStatus func() ([]byte, error)
+	// zdb -C <pool>; if nil, vdev ashift is not captured
+	ZdbConfig func(pool string) ([]byte, error)
+	// zfs holds -H <snapshot...>; if nil, snapshot holds are not captured.
+	// Called in batches of snapshots with a nonzero userrefs, so that no one
+	// command line grows too long. RunnerInput leaves this unset, see HoldsRunner.
+	ZfsHolds func(snapshots []string) ([]byte, error)
+	// zfs version of the host the inferred commands are to be run on; if nil
+	// or failing, as before zfs 0.8, features are not checked against it
+	ZfsVersion func() (Version, error)
+	// zfs allow <dataset>; if nil, delegated permissions are not captured.
+	// RunnerInput leaves this unset as it runs once per dataset, see AllowRunner.
+	ZfsAllow func(dataset string) ([]byte, error)
+
+	// Tolerate properties inherited from datasets missing from the input, as in
+	// a filtered capture. They are emitted as if local, with a warning.
+	PartialInput bool
+
+	// Datasets may be listed in any order, as in a hand-edited capture. The
+	// zfs get all output is then reordered so that parents precede their
+	// children, keeping the input order otherwise.
+	Unordered bool
+
+	// Skip malformed zfs get all lines rather than failing on the first one.
+	// ImportedPoolsFrom then returns the pools it could parse along with
+	// ParseErrors describing every skipped line. Datasets missing between a
+	// dataset and its nearest ancestor in the input are skipped with a warning.
+	ContinueOnError bool
+}
+
+// RunnerInput obtains the output of each command from r
+func RunnerInput(r CommandRunner) *Input {
+	return &Input{
+		ZfsGetAll:   func() (io.ReadCloser, error) { return zfsGetAllRaw(r) },
+		ZpoolGetAll: func() ([]byte, error) { return zpoolGetAllRaw(r) },
+		ZpoolStatus: func() ([]byte, error) { return zpoolStatusRaw(r) },
+		ZdbConfig:   func(pool string) ([]byte, error) { return zdbConfigRaw(r, pool) },
+		ZfsVersion:  cachedVersion(r),
+	}
+}
+
+// ParseableInput is RunnerInput using zfs get -p and zpool get -p, so sizes and
+// other numeric values are exact rather than rounded for display
+func ParseableInput(r CommandRunner) *Input {
+	in := RunnerInput(r)
+	in.ZfsGetAll = func() (io.ReadCloser, error) { return zfsGetAllRaw(r, `-p`) }
+	in.ZpoolGetAll = func() ([]byte, error) { return zpoolGetAllRaw(r, `-p`) }
+	return in
+}
+
+// JSONInput is RunnerInput using zfs get -j and zpool get -j, which require
+// OpenZFS 2.3 or later
+func JSONInput(r CommandRunner) *Input {
+	in := RunnerInput(r)
+	in.ZfsGetAll = func() (io.ReadCloser, error) { return zfsGetAllRaw(r, `-j`) }
+	in.ZpoolGetAll = func() ([]byte, error) { return zpoolGetAllRaw(r, `-j`) }
+	return in
+}
+
+// DetectInput is JSONInput if the zfs version reported by r supports get -j,
+// or otherwise RunnerInput
+func DetectInput(r CommandRunner) *Input {
+	in := RunnerInput(r)
+	if v, err := in.ZfsVersion(); err == nil && v.SupportsJSON() {
+		in.ZfsGetAll = func() (io.ReadCloser, error) { return zfsGetAllRaw(r, `-j`) }
+		in.ZpoolGetAll = func() ([]byte, error) { return zpoolGetAllRaw(r, `-j`) }
+	}
+	return in
+}
+
+// HoldsRunner obtains zfs holds output from r, for use as Input.ZfsHolds
+func HoldsRunner(r CommandRunner) func(snapshots []string) ([]byte, error) {
+	return func(snapshots []string) ([]byte, error) { return zfsHoldsRaw(r, snapshots) }
+}
+
+// AllowRunner obtains zfs allow output from r, for use as Input.ZfsAllow
+func AllowRunner(r CommandRunner) func(dataset string) ([]byte, error) {
+	return func(dataset string) ([]byte, error) { return zfsAllowRaw(r, dataset) }
+}
+
+// ParseProperties infers pools from captured zfs get all and zpool get all
+// output, in any of the formats ImportedPoolsFrom accepts and with datasets in
+// any order. The pools have no vdevs, holds, or permissions.
+func ParseProperties(zfsGetAll, zpoolGetAll []byte) (map[string]*Pool, error) {
+	return ImportedPoolsFrom(&Input{
+		ZfsGetAll:   func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(zfsGetAll)), nil },
+		ZpoolGetAll: func() ([]byte, error) { return zpoolGetAll, nil },
+		Unordered:   true,
+	})
+}
+
+func ImportedPools() (map[string]*Pool, error) {
+	return ImportedPoolsContext(context.Background())
+}
+
+// Any zfs, zpool, or zdb process still running is killed when ctx is done
+func ImportedPoolsContext(ctx context.Context) (map[string]*Pool, error) {
+	pools, err := ImportedPoolsWith(ExecRunner(ctx))
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: %s", ctx.Err(), err)
+	}
+	return pools, err
+}
+
+// The input format is chosen by the zfs version reported by r, see DetectInput
+func ImportedPoolsWith(r CommandRunner) (map[string]*Pool, error) {
+	return ImportedPoolsFrom(DetectInput(r))
+}
+
+// If in is nil, the commands are run with DetectInput(DefaultRunner)
+func ImportedPoolsFrom(in *Input) (map[string]*Pool, error) {
+	if in == nil {
+		in = DetectInput(DefaultRunner)
+	}
+
+	// The two are independent, and each may take seconds on large systems
+	var zpoolOut []byte
+	var zfsOut io.ReadCloser
+	var g errgroup.Group
+	g.Go(func() (err error) {
+		if zpoolOut, err = in.ZpoolGetAll(); err != nil {
+			return fmt.Errorf("zpool get all: %w", err)
+		}
+		return nil
+	})
+	g.Go(func() (err error) {
+		if zfsOut, err = in.ZfsGetAll(); err != nil {
+			return fmt.Errorf("zfs get all: %w", err)
+		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		if zfsOut != nil {
+			zfsOut.Close()
+		}
+		return nil, err
+	}
+
+	poolProps, err := zpoolParse(zpoolOut)
+	if err != nil {
+		zfsOut.Close()
+		return nil, fmt.Errorf("error parsing zpool get all: %w", err)
+	}
+
+	var r io.Reader = zfsOut
+	if in.Unordered {
+		if r, err = orderGetAll(r); err != nil {
+			zfsOut.Close()
+			return nil, fmt.Errorf("zfs get all: %w", err)
+		}
+	}
+
+	getAll := &parser{continueOnError: in.ContinueOnError, partialInput: in.PartialInput}
+	pools, err := getAll.parseGetAll(r, poolProps)
+	if _, ok := err.(inputEOF); !ok {
+		zfsOut.Close()
+		return nil, fmt.Errorf("error parsing zfs get all: %w", err)
+	}
+	// Output cut short by a failing zfs may still have parsed
+	if err := zfsOut.Close(); err != nil {
+		return nil, fmt.Errorf("zfs get all: %w", err)
+	}
+
+	if in.ZfsVersion != nil {
+		if v, err := in.ZfsVersion(); err == nil {
+			warnUnsupportedFeatures(pools, v)
+		}
+	}
+
+	var b []byte
+	if in.ZfsHolds != nil {
+		held := heldSnapshots(pools)
+		for len(held) != 0 {
+			batch := held
+			if len(batch) > holdsBatchSize {
+				batch = batch[:holdsBatchSize]
+			}
+			held = held[len(batch):]
+
+			if b, err = in.ZfsHolds(batch); err != nil {
+				return nil, fmt.Errorf("zfs holds: %w", err)
+			}
+			holds, err := parseHolds(b)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing zfs holds: %w", err)
+			}
+			attachHolds(pools, holds)
+		}
+	}
+
+	if in.ZfsAllow != nil {
+		for _, pool := range pools {
+			for _, set := range pool.Datasets.Ordered {
+				b, err = in.ZfsAllow(set.Name)
+				if err != nil {
+					return nil, err
+				}
+
+				if set.Permissions, err = parseAllow(set.Name, b); err != nil {
+					return nil, fmt.Errorf("error parsing zfs allow %s: %w", set.Name, err)
+				}
+			}
+		}
+	}
+
+	if in.ZpoolStatus == nil {
+		return pools, getAll.err()
+	}
+
+	b, err = in.ZpoolStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	vdevs, err := zpoolStatusParse(b)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing zpool status: %w", err)
+	}
+
+	for _, pool := range pools {
+		v, ok := vdevs[pool.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing vdev topology: %s", pool.Name)
+		}
+		pool.Vdevs = v
+
+		if in.ZdbConfig == nil {
+			continue
+		}
+
+		// zdb can't open pools without a cachefile, so ashift is best effort
+		b, err = in.ZdbConfig(pool.Name)
+		if err == nil {
+			v.Ashift, err = zdbAshiftParse(b)
+		}
+		if err != nil {
+			Warnf("unable to read ashift of %s: %s", pool.Name, err)
+		}
+	}
+
+	return pools, getAll.err()
+}
+
+// Returns the encryption root of set if it is encrypted and not its own root
+func (p *Pool) encryptionRootOf(set *Dataset) (*Dataset, error) {
+	er, ok := set.Properties[encryptionRoot]
+	if !ok || er.Value() == "" || er.Value() == set.Name {
+		return nil, nil
+	}
+
+	rootSet, ok := p.Datasets.Index[er.Value()]
+	if !ok {
+		return nil, fmt.Errorf("%s encryptionroot %s not found", set.Name, er.Value())
+	}
+
+	if rootRoot, ok := rootSet.Properties[encryptionRoot]; !ok || rootRoot.Value() != er.Value() {
+		return nil, fmt.Errorf("encryptionroot %s of child %s is not self-rooted: %s != %s", rootSet.Name, set.Name, rootRoot.Value(), rootSet.Name)
+	}
+	return rootSet, nil
+}
+
+func fixInheritance(pools map[string]*Pool, partial, continueOnError bool) error {
+	for _, pool := range pools {
+		ancestors := newAncestry(pool, partial, continueOnError)
+		for _, set := range pool.Datasets.Ordered {
+			rootSet, err := pool.encryptionRootOf(set)
+			if err != nil {
+				// The encryption root of a clone may be that of its origin,
+				// which need not be self-rooted or part of the input
+				if set.origin() == "" {
+					return err
+				}
+				set.ExternalEncryptionRoot = set.Properties[encryptionRoot].Value()
+			} else if rootSet != nil {
+				// Non-parent encryptionroot is possible via cloning, but we don't set up inheritance here as command inference gets confusing
+				if !isParent(set.Name, rootSet.Name) {
+					set.ExternalEncryptionRoot = rootSet.Name
+				} else {
+					for propName := range encryptionInheritedProperties {
+						rootProp, ok := rootSet.Properties[propName]
+						if !ok {
+							return fmt.Errorf("encrypted dataset %s is missing property: %s", rootSet.Name, propName)
+						}
+
+						selfProp, ok := set.Properties[propName]
+						if !ok {
+							return fmt.Errorf("encrypted dataset %s is missing property: %s", set.Name, propName)
+						}
+
+						if _, ok := encryptionLocalProperties[propName]; ok && rootProp.Value() != selfProp.Value() {
+							continue
+						}
+						if selfProp.changedKey(rootProp) {
+							continue
+						}
+
+						selfProp.Source = PropertySource{
+							Location:  PropertyInherited,
+							Parent:    rootSet.Name,
+							Inherited: rootProp,
+						}
+					}
+				}
+			}
+
+			if !isRootDataset(set.Name) {
+				if _, err := ancestors.parent(set); err != nil {
+					return err
+				}
+
+				// A readonly property matching the nearest ancestor that has it is inherited from that ancestor
+				for _, prop := range set.Properties {
+					if prop.Source.Location != PropertyReadonly || !prop.nonEncryptionInherit() {
+						continue
+					}
+					a, err := ancestors.withProperty(set, prop.Name)
+					if err != nil {
+						return err
+					}
+					if a == nil {
+						continue
+					}
+					if parentProp := a.Properties[prop.Name]; parentProp.Value() == prop.Value() {
+						prop.Source = PropertySource{
+							Location:  PropertyInherited,
+							Parent:    a.Name,
+							Inherited: parentProp,
+							readonly:  true,
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseGetAll(b []byte, poolProps map[string]map[string]*Property) (map[string]*Pool, error) {
+	return (&parser{}).parseGetAll(bytes.NewReader(b), poolProps)
+}
+
+func (p *parser) parseGetAll(r io.Reader, poolProps map[string]map[string]*Property) (map[string]*Pool, error) {
+	r, err := jsonReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p.scanner = zfscli.NewLineScanner(r)
+	first, _ := p.next()
+	if err := p.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if isTabSeparated(first) {
+		p.tabs = true
+		p.pushBack(first)
+	} else if !header.Match(first) {
+		return nil, fmt.Errorf("unexpected header: %s", first)
+	}
+	p.snapshotIndex = make(map[string]*Snapshot)
+	p.bookmarkIndex = make(map[string]*Bookmark)
+
+	pools := make(map[string]*Pool)
+	for {
+		pool, err := p.parsePool()
+		if pool != nil {
+			props, ok := poolProps[pool.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing pool properties: %s", pool.Name)
+			}
+			pool.Properties = props
+		}
+
+		switch err.(type) {
+		case nextPool:
+			pools[pool.Name] = pool
+		case inputEOF:
+			if pool != nil {
+				pools[pool.Name] = pool
+			}
+			attachSnapshots(pools, p.snapshots, p.bookmarks)
+			if err := fixInheritance(pools, p.partialInput, p.continueOnError); err != nil {
+				return nil, err
+			}
+			return pools, err
+		default:
+			return nil, err
+		}
+	}
+}
+
+type parser struct {
+	scanner *bufio.Scanner
+	// Lines to read again before continuing with scanner
+	unread []unreadLine
+	// Number of the line last returned by next, counting from 1
+	line int
+	// Lines read from scanner
+	scanned int
+
+	// Snapshots and bookmarks in input order, attached to their datasets once parsing completes
+	snapshots     []*Snapshot
+	snapshotIndex map[string]*Snapshot
+	bookmarks     []*Bookmark
+	bookmarkIndex map[string]*Bookmark
+
+	// Input is zfs get -H output
+	tabs bool
+	// Reused by match
+	m [6][]byte
+
+	// Treat properties inherited from datasets missing from the input as local
+	partialInput bool
+
+	// Skip malformed lines, collecting their errors in errs
+	continueOnError bool
+	errs            ParseErrors
+}
+
+type unreadLine struct {
+	b   []byte
+	num int
+}
+
+// Returns the next line of input, or false at the end of input
+func (p *parser) next() ([]byte, bool) {
+	if len(p.unread) != 0 {
+		l := p.unread[0]
+		p.unread = p.unread[1:]
+		p.line = l.num
+		return l.b, true
+	}
+	if !p.scanner.Scan() {
+		return nil, false
+	}
+	p.scanned++
+	p.line = p.scanned
+	// Only valid until the next call, unless pushed back
+	return p.scanner.Bytes(), true
+}
+
+// Returns lines, in the order they were read, to be read again by next. They
+// must be the lines most recently returned by next.
+func (p *parser) pushBack(lines ...[]byte) {
+	unread := make([]unreadLine, 0, len(lines)+len(p.unread))
+	for i, l := range lines {
+		unread = append(unread, unreadLine{b: append([]byte(nil), l...), num: p.line - len(lines) + 1 + i})
+	}
+	p.unread = append(unread, p.unread...)
+}
+
+// Returns the submatches of property for a line of input, or nil if unparseable
+// The result is only valid until the next call.
+func (p *parser) match(l []byte) [][]byte {
+	m := p.m[:]
+	if !p.tabs {
+		loc := property.FindSubmatchIndex(l)
+		if loc == nil {
+			return nil
+		}
+		for i := range m {
+			m[i] = nil
+			if loc[2*i] >= 0 {
+				m[i] = l[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		return m
+	}
+
+	m[0], m[5] = l, nil
+	rest := l
+	for i := 1; i < 4; i++ {
+		tab := bytes.IndexByte(rest, '\t')
+		if tab < 0 {
+			return nil
+		}
+		m[i], rest = rest[:tab], rest[tab+1:]
+	}
+	if bytes.IndexByte(rest, '\t') >= 0 {
+		return nil
+	}
+	m[4] = rest
+	if inherited := []byte("inherited from "); bytes.HasPrefix(rest, inherited) {
+		m[4], m[5] = inherited, rest[len(inherited):]
+	}
+	return m
+}
+
+// Source column values, so that looking them up does not allocate
+var sourceNames = map[string]string{
+	"-":               "-",
+	"default":         "default",
+	"local":           "local",
+	"received":        "received",
+	"temporary":       "temporary",
+	"inherited from ": "inherited from ",
+}
+
+func sourceName(b []byte) string {
+	if name, ok := sourceNames[string(b)]; ok {
+		return name
+	}
+	return string(b)
+}
+
+// Returns the source of a property inherited from a dataset missing from
+// partial input, which has no Inherited property and so is emitted as local
+func (p *parser) missingParent(setName, name string, err error) (PropertySource, error) {
+	parent, ok := err.(unknownParent)
+	if !ok || !p.partialInput {
+		return PropertySource{}, err
+	}
+	Warnf("%s inherits %s from %s, which is not in the input; treating it as local", setName, name, string(parent))
+	return PropertySource{Location: PropertyInherited, Parent: string(parent)}, nil
+}
+
+// Returns err, or records it and returns nil if continuing on error
+func (p *parser) lineError(err error) error {
+	if !p.continueOnError {
+		return err
+	}
+	p.errs = append(p.errs, err)
+	return nil
+}
+
+// Returns the errors of skipped lines, or nil if there were none
+func (p *parser) err() error {
+	if len(p.errs) == 0 {
+		return nil
+	}
+	return p.errs
+}
+
+// ParseErrors are the malformed lines skipped when Input.ContinueOnError is set
+type ParseErrors []error
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type nextPool string
+
+func (n nextPool) Error() string {
+	return string(n)
+}
+
+type unknownParent string
+
+func (u unknownParent) Error() string {
+	return fmt.Sprintf("inherits from %s, %s", string(u), missingFromInput)
+}
+
+// Explains an ancestor missing from the input, as in a capture that was cut
+// short or filtered, or that lists children before their parents
+const missingFromInput = "which is missing from the input; the capture may be incomplete or out of order"
+
+type inputEOF struct{}
+
+func (e inputEOF) Error() string {
+	return fmt.Sprintf("end of input")
+}
+
+func newPool(name nextPool) (*Pool, error) {
+	if !isRootDataset(string(name)) {
+		root := strings.SplitN(string(name), "/", 2)[0]
+		return nil, fmt.Errorf("%s precedes its root dataset %s, %s", name, root, missingFromInput)
+	}
+
+	pool := &Pool{
+		Name: string(name),
+	}
+	pool.Datasets.Index = make(map[string]*Dataset)
+	return pool, nil
+}
+
+func (p *parser) parsePool() (*Pool, error) {
+	_, err := p.parseDataset(nil)
+	name, ok := err.(nextPool)
+	if !ok {
+		return nil, err
+	}
+
+	pool, err := newPool(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		set, err := p.parseDataset(pool)
+		if err == nil {
+			if e := pool.addDataset(set); e != nil {
+				return nil, e
+			}
+			continue
+		}
+
+		switch err := err.(type) {
+		case nextPool:
+			return pool, err
+		case inputEOF:
+			if e := pool.addDataset(set); e != nil {
+				return nil, e
+			}
+			return pool, err
+		default:
+			return nil, err
+		}
+	}
+}
+
+// if pool is nil, does not parse and returns nextPool
+func (p *parser) parseDataset(pool *Pool) (*Dataset, error) {
+	set := &Dataset{
+		Properties: make(map[string]*Property),
+	}
+
+	// Lines read before the first line of set, which are read again if it starts a new pool
+	var read [][]byte
+	for {
+		l, ok := p.next()
+		if !ok {
+			break
+		}
+		if set.Name == "" {
+			read = append(read, append([]byte(nil), l...))
+		}
+
+		l = bytes.TrimSpace(l)
+		if len(l) == 0 {
+			continue
+		}
+
+		m := p.match(l)
+		if m == nil {
+			// Lines skipped while looking for the next pool are seen again when it is parsed
+			if pool == nil && p.continueOnError {
+				continue
+			}
+			if err := p.lineError(&UnparseableLineError{Line: string(l), LineNum: p.line}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Converted to a string only once it is kept
+		setName := m[1]
+		if bytes.ContainsAny(setName, "@#") {
+			if pool != nil {
+				if err := p.parseChildProperty(pool, set, m); err != nil {
+					if err := p.lineError(fmt.Errorf("line %d: %w", p.line, err)); err != nil {
+						return nil, err
+					}
+				}
+			}
+			continue
+		}
+
+		if set.Name == "" {
+			if pool == nil {
+				p.pushBack(read...)
+				return nil, nextPool(setName)
+			}
+
+			if name := string(setName); name != set.Name {
+				if name != pool.Name && !isParent(name, pool.Name) {
+					p.pushBack(read...)
+					return nil, nextPool(name)
+				}
+				set.Name = name
+				read = nil
+			} else {
+				panic("blank set name")
+			}
+		} else {
+			if string(setName) != set.Name {
+				p.pushBack(l)
+				return set, nil
+			}
+		}
+
+		name := string(m[2])
+		value := string(m[3])
+		src, err := parseSource(name, value, sourceName(m[4]), string(m[5]), pool)
+		if err != nil {
+			src, err = p.missingParent(set.Name, name, err)
+		}
+		if err != nil {
+			if err := p.lineError(fmt.Errorf("line %d: %s %w", p.line, set.Name, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		set.Properties[name] = &Property{
+			Name:       name,
+			localValue: value,
+			Source:     src,
+		}
+	}
+
+	if err := p.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, inputEOF{}
+}
@@ -0,0 +1,1814 @@
+package zfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type expectSet struct {
+	SetName    string
+	Properties []Property
+}
+
+func TestParseGetAll(t *testing.T) {
+	assert := require.New(t)
+
+	poolInput := []byte(`NAME PROPERTY   VALUE     SOURCE
+foo  feature@d  disabled  local
+foo  feature@e  enabled   local
+foo  feature@a  active    local
+
+bar  feature@d  disabled  local
+bar  feature@e  enabled   local
+bar  feature@a  active    local`)
+
+	input := []byte(`NAME         PROPERTY        VALUE       SOURCE
+foo          fizz            buzz        default
+foo          mounted         no          -
+foo/bar      buzz            fizz        -
+
+fizz@buzz    nope            nah         -
+
+bar          zzup            zzip        local
+bar          xxup            xxip        -
+bar/foo      mounted         yes         -
+bar/foo      encryptionroot  bar/foo     -
+bar/foo      encryption      foobar      -
+bar/foo      keystatus       available   -
+bar/foo      keylocation     prompt      received
+bar/foo      keyformat       passphrase  -
+bar/foo      pbkdf2iters     342K        -
+bar/foo/bar  encryptionroot  bar/foo     -
+bar/foo/bar  encryption      fizzybar    -
+bar/foo/bar  keylocation     none        default
+bar/foo/bar  keyformat       passphrase  -
+bar/foo/bar  pbkdf2iters     342K        -
+bar/foo/bar  keystatus       available   -
+bar/foo/bar  readonly        on          temporary
+bar/foo/bar  zzup            zzip        inherited from bar
+bar/foo/bar  xxup            xxip        -`)
+
+	expected := map[string][]expectSet{
+		"foo": {
+			{
+				SetName: "foo",
+				Properties: []Property{
+					{
+						Name:       "fizz",
+						localValue: "buzz",
+						Source: PropertySource{
+							Location: PropertyDefault,
+						},
+					},
+					{
+						Name:       "mounted",
+						localValue: "no",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+				},
+			},
+			{
+				SetName: "foo/bar",
+				Properties: []Property{
+					{
+						Name:       "buzz",
+						localValue: "fizz",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+				},
+			},
+		},
+		"bar": {
+			{
+				SetName: "bar",
+				Properties: []Property{
+					{
+						Name:       "zzup",
+						localValue: "zzip",
+						Source: PropertySource{
+							Location: PropertyLocal,
+						},
+					},
+					{
+						Name:       "xxup",
+						localValue: "xxip",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+				},
+			},
+			{
+				SetName: "bar/foo",
+				Properties: []Property{
+					{
+						Name:       "mounted",
+						localValue: "yes",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+					{
+						Name:       "encryptionroot",
+						localValue: "bar/foo",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+					{
+						Name:       "encryption",
+						localValue: "foobar",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+					{
+						Name:       "keystatus",
+						localValue: "available",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+					{
+						Name:       "keylocation",
+						localValue: "prompt",
+						Source: PropertySource{
+							Location: PropertyReceived,
+						},
+					},
+					{
+						Name:       "keyformat",
+						localValue: "passphrase",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+					{
+						Name:       "pbkdf2iters",
+						localValue: "342K",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+				},
+			},
+			{
+				SetName: "bar/foo/bar",
+				Properties: []Property{
+					{
+						Name:       "zzup",
+						localValue: "zzip",
+						Source: PropertySource{
+							Location: PropertyInherited,
+							Parent:   "bar",
+						},
+					},
+					{
+						Name:       "xxup",
+						localValue: "xxip",
+						Source: PropertySource{
+							Location: PropertyInherited,
+							Parent:   "bar",
+						},
+					},
+					{
+						Name:       "readonly",
+						localValue: "on",
+						Source: PropertySource{
+							Location: PropertyTemporary,
+						},
+					},
+					{
+						Name:       "encryptionroot",
+						localValue: "bar/foo",
+						Source: PropertySource{
+							Location: PropertyInherited,
+							Parent:   "bar/foo",
+						},
+					},
+					{
+						Name:       "encryption",
+						localValue: "fizzybar",
+						Source: PropertySource{
+							Location: PropertyReadonly,
+						},
+					},
+					{
+						Name:       "keystatus",
+						localValue: "available",
+						Source: PropertySource{
+							Location: PropertyInherited,
+							Parent:   "bar/foo",
+						},
+					},
+					{
+						Name:       "keylocation",
+						localValue: "prompt",
+						Source: PropertySource{
+							Location: PropertyInherited,
+							Parent:   "bar/foo",
+						},
+					},
+					{
+						Name:       "keyformat",
+						localValue: "passphrase",
+						Source: PropertySource{
+							Location: PropertyInherited,
+							Parent:   "bar/foo",
+						},
+					},
+					{
+						Name:       "pbkdf2iters",
+						localValue: "342K",
+						Source: PropertySource{
+							Location: PropertyInherited,
+							Parent:   "bar/foo",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	dummyPools, err := zpoolParse(poolInput)
+	assert.NoError(err)
+	dummyPools["fizz"] = make(map[string]*Property)
+
+	pools, err := parseGetAll(input, dummyPools)
+	assert.EqualError(err, "end of input")
+
+	assert.Len(pools, len(expected))
+
+	for _, p := range pools {
+		expected := expected[p.Name]
+		assert.Len(p.Datasets.Ordered, len(expected))
+		assert.Len(p.Datasets.Index, len(expected))
+
+		for i, expect := range expected {
+			set := p.Datasets.Ordered[i]
+
+			assert.Equal(expect.SetName, set.Name)
+			assert.Len(set.Properties, len(expect.Properties), "%s properties", set.Name)
+
+			for _, p := range expect.Properties {
+				assert.Contains(set.Properties, p.Name)
+				assert.Equal(p.localValue, set.Properties[p.Name].Value(), "property %s on %s", p.Name, set.Name)
+				assert.Equal(p.Source.Location, set.Properties[p.Name].Source.Location, "property %s source location on %s", p.Name, set.Name)
+				assert.Equal(p.Source.Parent, set.Properties[p.Name].Source.Parent)
+			}
+		}
+	}
+
+	expectCmd := []string{
+		`zpool create -d -o feature@a=enabled -o feature@e=enabled foo`,
+		`zfs create -o buzz=fizz foo/bar`,
+		`zpool create -d -o feature@a=enabled -O xxup=xxip -O zzup=zzip bar`,
+		`zfs create -o encryption=foobar -o keyformat=passphrase -o keylocation=prompt -o pbkdf2iters=342K bar/foo`,
+		`zfs create -o encryption=fizzybar bar/foo/bar`,
+	}
+	sort.Strings(expectCmd)
+
+	var actual []string
+	for _, pool := range pools {
+		cmdline, err := pool.CreatePoolCommand(&FlagOptions{DisableAllFeatures: true, MinimalFeatures: pool.Name == "bar"})
+		assert.NoError(err)
+		actual = append(actual, strings.Join(cmdline, " "))
+		for i, dataset := range pool.Datasets.Ordered {
+			if i == 0 {
+				continue
+			}
+			cmdline, err = pool.CreateDatasetCommand(dataset.Name, nil)
+			assert.NoError(err)
+			actual = append(actual, strings.Join(cmdline, " "))
+		}
+	}
+	sort.Strings(actual)
+	assert.Equal(expectCmd, actual)
+
+	// Without -d, disabled features are emitted so they stay disabled
+	for name, expect := range map[string]string{
+		"foo": "zpool create -o feature@a=enabled -o feature@d=disabled -o feature@e=enabled foo",
+		"bar": "zpool create -o feature@a=enabled -o feature@d=disabled -O xxup=xxip -O zzup=zzip bar",
+	} {
+		opts := NewFlagOptions(WithDisableAllFeatures(false), WithMinimalFeatures(name == "bar"))
+		cmdline, err := pools[name].CreatePoolCommand(opts)
+		assert.NoError(err)
+		assert.Equal(expect, strings.Join(cmdline, " "))
+	}
+}
+
+func TestIsParent(t *testing.T) {
+	assert := require.New(t)
+
+	assert.True(isParent("foo/foo/bar", "foo/foo"))
+	assert.False(isParent("foo/foo/bar", "foo/bar"))
+}
+
+func TestParseFailures(t *testing.T) {
+	assert := require.New(t)
+
+	cases := map[string]string{
+		"line 2: unparseable input: xyz": `NAME  PROPERTY  VALUE  SOURCE
+xyz`,
+		"unexpected header: foo": `foo`,
+		"line 2: foo property mounted expected to be readonly": `NAME  PROPERTY  VALUE  SOURCE
+foo  mounted  yes  default`,
+		"foo already contains a dataset named foo": `NAME  PROPERTY  VALUE  SOURCE
+foo      mounted  yes  -
+foo/bar  mounted  yes  -
+foo/foo  mounted  yes  -
+foo  mounted  yes  -`,
+		"bar already contains a dataset named bar": `NAME  PROPERTY  VALUE  SOURCE
+bar      mounted  yes  -
+bar/bar  mounted  yes  -
+bar      mounted  yes  -
+bar/foo  mounted  yes  -`,
+		"line 3: foo/bar inherited property fizz does not match value on parent foo: fuzz != buzz": `NAME  PROPERTY  VALUE  SOURCE
+foo      fizz  buzz   local
+foo/bar  fizz  fuzz   inherited from foo`,
+		"line 3: foo/bar inherited property mountpoint does not match value on parent foo: legacy/bar != legacy": `NAME  PROPERTY  VALUE  SOURCE
+foo      mountpoint  legacy      local
+foo/bar  mountpoint  legacy/bar  inherited from foo`,
+		"line 3: foo/bar parent foo does not contain property buzz": `NAME  PROPERTY  VALUE  SOURCE
+foo      fizz  buzz   local
+foo/bar  buzz  fuzz   inherited from foo`,
+		"line 2: foo inherits from bar, which is missing from the input; the capture may be incomplete or out of order": `NAME  PROPERTY  VALUE  SOURCE
+foo      fizz  buzz   inherited from bar`,
+		"foo/bar precedes its root dataset foo, which is missing from the input; the capture may be incomplete or out of order": `NAME  PROPERTY  VALUE  SOURCE
+foo/bar  fizz  buzz   -`,
+		"foo/bar encryptionroot bar not found": `NAME  PROPERTY  VALUE  SOURCE
+foo      fizz            buzz   -
+foo/bar  encryptionroot  bar    -`,
+		"encryptionroot foo/bar of child foo is not self-rooted: bar != foo/bar": `NAME  PROPERTY  VALUE  SOURCE
+foo      encryptionroot  foo/bar  -
+foo/bar  encryptionroot  bar      -`,
+	}
+
+	dummyPools := map[string]map[string]*Property{
+		"xyz": make(map[string]*Property),
+		"foo": make(map[string]*Property),
+		"bar": make(map[string]*Property),
+	}
+	for out, in := range cases {
+		_, err := parseGetAll([]byte(in), dummyPools)
+		assert.EqualError(err, out)
+	}
+}
+
+func TestZpoolSources(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	props, err := zpoolParse([]byte(`NAME  PROPERTY               VALUE                 SOURCE
+tank  size                   928G                  -
+tank  ashift                 12                    local
+tank  autotrim               on                    LOCAL
+tank  readonly               on                    temporary
+tank  cachefile              none                  inherited from boot
+tank  comment                -                     default
+tank  feature@async_destroy  enabled               local`))
+	assert.NoError(err)
+	tank := props["tank"]
+	assert.Equal(PropertyLocal, tank["autotrim"].Source.Location)
+	assert.Equal(PropertyTemporary, tank["readonly"].Source.Location)
+	assert.Equal(PropertyLocal, tank["cachefile"].Source.Location)
+	assert.Equal([]string{`tank property cachefile has unrecognized source "inherited from boot", treating it as local`}, warnings)
+}
+
+func TestZpoolInformationalRows(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings, omitted []string
+	defer func(w, o func(string, ...interface{})) { Warnf, Omitf = w, o }(Warnf, Omitf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+	Omitf = func(format string, v ...interface{}) {
+		omitted = append(omitted, fmt.Sprintf(format, v...))
+	}
+
+	pools, err := ParseProperties([]byte(`NAME  PROPERTY  VALUE       SOURCE
+tank  type      filesystem  -`), []byte(`NAME  PROPERTY                        VALUE                 SOURCE
+tank  size                            928G                  -
+tank  capacity                        1%                    -
+tank  health                          ONLINE                -
+tank  guid                            8224174125385620231   -
+tank  load_guid                       4710235627413376420   default
+tank  ashift                          12                    local
+tank  autotrim                        on                    local
+tank  bcloneused                      0                     -
+tank  bclonesaved                     0                     -
+tank  bcloneratio                     1.00x                 -
+tank  dedup_table_size                0                     -
+tank  feature@async_destroy           enabled               local
+tank  feature@lz4_compress            active                local
+tank  unsupported@com.example:future  readonly              local
+tank  unsupported@com.example:other   inactive              local`))
+	assert.NoError(err)
+
+	cmdline, err := pools["tank"].CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o ashift=12 -o feature@async_destroy=enabled -o feature@lz4_compress=enabled tank", strings.Join(cmdline, " "))
+	assert.NotContains(pools["tank"].Properties, "load_guid")
+	assert.Contains(omitted, "tank: skipping load_guid (informational)")
+	assert.Equal([]string{
+		"tank has unsupported@com.example:future=readonly, a feature this zpool does not support; it will be left out",
+		"tank has unsupported@com.example:other=inactive, a feature this zpool does not support; it will be left out",
+	}, warnings)
+}
+
+func TestTypedParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	dummyPools := map[string]map[string]*Property{"foo": {}}
+
+	_, err := parseGetAll([]byte(`NAME  PROPERTY  VALUE  SOURCE
+xyz`), dummyPools)
+	var unparseable *UnparseableLineError
+	assert.True(errors.As(err, &unparseable))
+	assert.Equal(UnparseableLineError{Line: "xyz", LineNum: 2}, *unparseable)
+
+	_, err = parseGetAll([]byte(`NAME  PROPERTY  VALUE  SOURCE
+foo      mounted  yes  -
+foo/bar  mounted  yes  -
+foo/baz  mounted  yes  -
+foo/bar  mounted  yes  -`), dummyPools)
+	var duplicate *DuplicateDatasetError
+	assert.True(errors.As(err, &duplicate))
+	assert.Equal(DuplicateDatasetError{Pool: "foo", Name: "foo/bar"}, *duplicate)
+
+	_, err = parseGetAll([]byte(`NAME  PROPERTY  VALUE  SOURCE
+foo      fizz  buzz   local
+foo/bar  fizz  fuzz   inherited from foo`), dummyPools)
+	var mismatch *InheritanceMismatchError
+	assert.True(errors.As(err, &mismatch))
+	assert.Equal(InheritanceMismatchError{Property: "fizz", Parent: "foo", Value: "fuzz", ParentValue: "buzz"}, *mismatch)
+
+	_, err = ParseProperties([]byte(`NAME  PROPERTY  VALUE       SOURCE
+foo   type      filesystem  -`), []byte(`NAME  PROPERTY  VALUE  SOURCE
+foo   ashift    12     local
+bar   ashift    12     local
+foo   ashift    12     local`))
+	assert.EqualError(err, "error parsing zpool get all: line 4: duplicate zpool found: foo")
+	var duplicatePool *DuplicatePoolError
+	assert.True(errors.As(err, &duplicatePool))
+	assert.Equal("foo", duplicatePool.Name)
+
+	_, err = zpoolParse([]byte("foo\tashift\t12\tlocal\nfoo\tcomment\tx\t\n"))
+	assert.EqualError(err, "line 2: property source for comment is missing")
+}
+
+func TestLegacyMountpoint(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME           PROPERTY    VALUE         SOURCE
+tank           type        filesystem    -
+tank           mountpoint  legacy        local
+tank/home      type        filesystem    -
+tank/home      mountpoint  legacy        inherited from tank
+tank/home/a    type        filesystem    -
+tank/home/a    mountpoint  legacy        inherited from tank
+tank/srv       type        filesystem    -
+tank/srv       mountpoint  /srv          local
+tank/srv/www   type        filesystem    -
+tank/srv/www   mountpoint  /srv/www      inherited from tank/srv
+tank/srv/none  type        filesystem    -
+tank/srv/none  mountpoint  none          local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	cmdline, err := pools["tank"].CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -O mountpoint=legacy tank", strings.Join(cmdline, " "))
+
+	expected := map[string]string{
+		"tank/home":     "zfs create tank/home",
+		"tank/home/a":   "zfs create tank/home/a",
+		"tank/srv":      "zfs create -o mountpoint=/srv tank/srv",
+		"tank/srv/www":  "zfs create tank/srv/www",
+		"tank/srv/none": "zfs create -o mountpoint=none tank/srv/none",
+	}
+	for name, out := range expected {
+		cmdline, err := pools["tank"].CreateDatasetCommand(name, nil)
+		assert.NoError(err)
+		assert.Equal(out, strings.Join(cmdline, " "), name)
+	}
+}
+
+func TestCreateVolumeCommand(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME      PROPERTY        VALUE       SOURCE
+tank      type            filesystem  -
+tank/vol  type            volume      -
+tank/vol  volsize         10G         local
+tank/vol  volblocksize    16K         -
+tank/vol  compression     zstd        local
+tank/vol  refreservation  10.3G       local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	cmdline, err := pools["tank"].CreateDatasetCommand("tank/vol", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -V 10G -b 16K -o compression=zstd -o refreservation=10.3G tank/vol", strings.Join(cmdline, " "))
+}
+
+func TestCreateDatasetNoMount(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME         PROPERTY      VALUE       SOURCE
+tank         type          filesystem  -
+tank         canmount      on          default
+tank/off     type          filesystem  -
+tank/off     canmount      off         local
+tank/noauto  type          filesystem  -
+tank/noauto  canmount      noauto      local
+tank/vol     type          volume      -
+tank/vol     volsize       1G          local
+tank/vol     volblocksize  16K         -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	expected := map[string][2]string{
+		"tank/off":    {"zfs create -o canmount=off tank/off", "zfs create -u -o canmount=off tank/off"},
+		"tank/noauto": {"zfs create -o canmount=noauto tank/noauto", "zfs create -u -o canmount=noauto tank/noauto"},
+		"tank/vol":    {"zfs create -V 1G -b 16K tank/vol", "zfs create -V 1G -b 16K tank/vol"},
+	}
+	for name, out := range expected {
+		cmdline, err := pools["tank"].CreateDatasetCommand(name, nil)
+		assert.NoError(err)
+		assert.Equal(out[0], strings.Join(cmdline, " "), name)
+
+		cmdline, err = pools["tank"].CreateDatasetCommand(name, &FlagOptions{NoMount: true})
+		assert.NoError(err)
+		assert.Equal(out[1], strings.Join(cmdline, " "), name)
+	}
+}
+
+func TestCreateParents(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME           PROPERTY     VALUE       SOURCE
+tank           type         filesystem  -
+tank           compression  lz4         local
+tank/a         type         filesystem  -
+tank/a         compression  lz4         inherited from tank
+tank/a/b       type         filesystem  -
+tank/a/b       atime        off         local
+tank/a/b/c     type         filesystem  -
+tank/a/b/c     atime        off         inherited from tank/a/b
+tank/leaf      type         filesystem  -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+	opts := &FlagOptions{CreateParents: true}
+
+	cmdline, err := pool.CreateDatasetCommand("tank/a/b", opts)
+	assert.NoError(err)
+	assert.Equal("zfs create -p -o atime=off tank/a/b", strings.Join(cmdline, " "))
+
+	// tank/a only inherits, so creating tank/a/b with -p creates it identically
+	assert.True(pool.Implied("tank/a", opts))
+	assert.False(pool.Implied("tank/a", nil))
+
+	// tank/a/b must be created before tank/a/b/c, or -p would create it without atime=off
+	assert.False(pool.Implied("tank/a/b", opts))
+	assert.False(pool.Implied("tank/a/b/c", opts))
+	assert.False(pool.Implied("tank/leaf", opts))
+	assert.False(pool.Implied("tank", opts))
+}
+
+func TestMultiWordComment(t *testing.T) {
+	assert := require.New(t)
+
+	// zpool get all pads every column but the last, so a row can end short
+	poolProps, err := zpoolParse([]byte(`NAME  PROPERTY  VALUE                SOURCE
+tank  comment   primary backup pool  local
+tank  ashift    12                   local`))
+	assert.NoError(err)
+	assert.Equal("primary backup pool", poolProps["tank"]["comment"].Value())
+
+	_, err = zpoolParse([]byte(`NAME  PROPERTY  VALUE                SOURCE
+tank  comment   primary backup pool  local
+tank  ashift`))
+	assert.EqualError(err, "line 3: property source for ashift is missing")
+
+	pools, err := parseGetAll([]byte(`NAME  PROPERTY  VALUE       SOURCE
+tank  type      filesystem  -`), poolProps)
+	assert.EqualError(err, "end of input")
+
+	commands, err := pools["tank"].CommandsFor("tank", nil)
+	assert.NoError(err)
+	var set []string
+	for _, c := range commands {
+		if c.Argv[1] == "set" {
+			set = append(set, c.Oneline())
+		}
+	}
+	assert.Equal([]string{"zpool set 'comment=primary backup pool' tank"}, set)
+}
+
+func TestAltrootAndCachefile(t *testing.T) {
+	assert := require.New(t)
+
+	poolInput := []byte(`NAME  PROPERTY   VALUE                SOURCE
+mnt   altroot    /mnt                 local
+mnt   cachefile  none                 local
+tank  altroot    -                    default
+tank  cachefile  /etc/zfs/tank.cache  local`)
+
+	input := []byte(`NAME  PROPERTY  VALUE       SOURCE
+mnt   type      filesystem  -
+tank  type      filesystem  -`)
+
+	poolProps, err := zpoolParse(poolInput)
+	assert.NoError(err)
+
+	pools, err := parseGetAll(input, poolProps)
+	assert.EqualError(err, "end of input")
+
+	cmdline, err := pools["tank"].CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o cachefile=/etc/zfs/tank.cache tank", strings.Join(cmdline, " "))
+
+	cmdline, err = pools["mnt"].CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d mnt", strings.Join(cmdline, " "))
+
+	cmdline, err = pools["mnt"].CreatePoolCommand(&FlagOptions{DisableAllFeatures: true, IncludeAltroot: true})
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o altroot=/mnt mnt", strings.Join(cmdline, " "))
+}
+
+func TestBootfs(t *testing.T) {
+	assert := require.New(t)
+
+	poolInput := []byte(`NAME   PROPERTY  VALUE              SOURCE
+rpool  bootfs    rpool/ROOT/ubuntu  local
+tank   bootfs    -                  default`)
+
+	input := []byte(`NAME               PROPERTY  VALUE       SOURCE
+rpool              type      filesystem  -
+rpool/ROOT         type      filesystem  -
+rpool/ROOT/ubuntu  type      filesystem  -
+tank               type      filesystem  -`)
+
+	poolProps, err := zpoolParse(poolInput)
+	assert.NoError(err)
+
+	pools, err := parseGetAll(input, poolProps)
+	assert.EqualError(err, "end of input")
+
+	cmdline, err := pools["rpool"].CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d rpool", strings.Join(cmdline, " "))
+
+	assert.Equal("rpool/ROOT/ubuntu", pools["rpool"].Bootfs())
+	cmdline, err = pools["rpool"].SetBootfsCommand()
+	assert.NoError(err)
+	assert.Equal("zpool set bootfs=rpool/ROOT/ubuntu rpool", strings.Join(cmdline, " "))
+
+	assert.Equal("", pools["tank"].Bootfs())
+	_, err = pools["tank"].SetBootfsCommand()
+	assert.EqualError(err, "bootfs is not set on pool tank")
+}
+
+func TestContinueOnError(t *testing.T) {
+	assert := require.New(t)
+
+	in := &Input{
+		ZpoolGetAll: func() ([]byte, error) {
+			return []byte(`NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    0      default`), nil
+		},
+		ZfsGetAll: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(`NAME         PROPERTY     VALUE       SOURCE
+tank         type         filesystem  -
+tank         compression  lz4         local
+tank         bogus
+tank/home    type         filesystem  -
+tank/home    mounted      yes         default
+tank/home    atime        off         local
+tank/home@a  type         snapshot    -
+tank/home@a  creation     1           local`)), nil
+		},
+	}
+
+	_, err := ImportedPoolsFrom(in)
+	assert.EqualError(err, "error parsing zfs get all: line 4: unparseable input: tank         bogus")
+
+	in.ContinueOnError = true
+	pools, err := ImportedPoolsFrom(in)
+	assert.EqualError(err, "line 4: unparseable input: tank         bogus; "+
+		"line 6: tank/home property mounted expected to be readonly; "+
+		"line 9: tank/home@a property creation expected to be readonly")
+	assert.Len(err.(ParseErrors), 3)
+
+	pool := pools["tank"]
+	assert.Len(pool.Datasets.Ordered, 2)
+	assert.NotContains(pool.Datasets.Index["tank/home"].Properties, "mounted")
+	assert.Equal("off", pool.Datasets.Index["tank/home"].Properties["atime"].Value())
+	assert.Len(pool.Datasets.Index["tank/home"].Snapshots, 1)
+
+	cmdline, err := pool.CreateDatasetCommand("tank/home", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o atime=off tank/home", strings.Join(cmdline, " "))
+}
+
+func TestOmitReasons(t *testing.T) {
+	assert := require.New(t)
+
+	var omitted []string
+	defer func(o func(string, ...interface{})) { Omitf = o }(Omitf)
+	Omitf = func(format string, v ...interface{}) {
+		omitted = append(omitted, fmt.Sprintf(format, v...))
+	}
+
+	poolInput := []byte(`NAME  PROPERTY   VALUE     SOURCE
+tank  altroot    /mnt      local
+tank  feature@a  enabled   local
+tank  feature@d  disabled  local`)
+
+	input := []byte(`NAME      PROPERTY        VALUE       SOURCE
+tank      type            filesystem  -
+tank      atime           on          default
+tank      encryptionroot  tank        -
+tank      encryption      on          -
+tank      keyformat       passphrase  -
+tank      keylocation     prompt      local
+tank      pbkdf2iters     342K        -
+tank      keystatus       available   -
+tank      compression     lz4         local
+tank/a    type            filesystem  -
+tank/a    compression     lz4         inherited from tank
+tank/a    encryptionroot  tank        -
+tank/a    encryption      on          -
+tank/a    keyformat       passphrase  -
+tank/a    keylocation     none        default
+tank/a    pbkdf2iters     342K        -
+tank/a    keystatus       available   -`)
+
+	poolProps, err := zpoolParse(poolInput)
+	assert.NoError(err)
+
+	pools, err := parseGetAll(input, poolProps)
+	assert.EqualError(err, "end of input")
+
+	_, err = pools["tank"].CreatePoolCommand(&FlagOptions{DisableAllFeatures: true, MinimalFeatures: true})
+	assert.NoError(err)
+	_, err = pools["tank"].CreateDatasetCommand("tank/a", nil)
+	assert.NoError(err)
+
+	assert.Equal([]string{
+		"tank: omitting altroot (transient import property)",
+		"tank: omitting feature@a (minimal-feature)",
+		"tank: omitting feature@d (disabled feature)",
+		"tank: omitting atime (default source)",
+		"tank: omitting encryptionroot (status-only)",
+		"tank: omitting keystatus (status-only)",
+		"tank: omitting type (status-only)",
+		"tank/a: omitting compression (inherited from tank)",
+		"tank/a: omitting encryption (inherited from tank)",
+		"tank/a: omitting encryptionroot (encryption-inherited)",
+		"tank/a: omitting keyformat (encryption-inherited)",
+		"tank/a: omitting keylocation (encryption-inherited)",
+		"tank/a: omitting keystatus (encryption-inherited)",
+		"tank/a: omitting pbkdf2iters (encryption-inherited)",
+		"tank/a: omitting type (status-only)",
+	}, omitted)
+}
+
+func TestIncludeProperties(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME    PROPERTY     VALUE       SOURCE
+tank    type         filesystem  -
+tank    compression  lz4         local
+tank    atime        off         local
+tank    org:note     keep        local
+tank/a  type         filesystem  -
+tank/a  compression  zstd        local
+tank/a  recordsize   1M          local`), []byte(`NAME  PROPERTY   VALUE    SOURCE
+tank  comment    backup   local
+tank  feature@a  active   local`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	opts := NewFlagOptions(WithIncludeProperties("compression", "recordsize", "feature@a", "nonexistent"))
+
+	cmdline, err := pool.CreatePoolCommand(opts)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o feature@a=enabled -O compression=lz4 tank", strings.Join(cmdline, " "))
+
+	cmdline, err = pool.CreateDatasetCommand("tank/a", opts)
+	assert.NoError(err)
+	assert.Equal("zfs create -o compression=zstd -o recordsize=1M tank/a", strings.Join(cmdline, " "))
+}
+
+func TestExcludeProperties(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME      PROPERTY        VALUE        SOURCE
+tank      type            filesystem   -
+tank      compression     lz4          local
+tank      mountpoint      /srv         local
+tank/a    type            filesystem   -
+tank/a    compression     zstd         local
+tank/a    mountpoint      /srv/a       inherited from tank
+tank/a    encryptionroot  tank/a       -
+tank/a    encryption      aes-256-gcm  -
+tank/a    keyformat       passphrase   -
+tank/a    keylocation     prompt       local
+tank/a    pbkdf2iters     350000       -
+tank/a    keystatus       available    -
+tank/a/b  type            filesystem   -
+tank/a/b  encryptionroot  tank/a       -
+tank/a/b  encryption      aes-256-gcm  -
+tank/a/b  keyformat       passphrase   -
+tank/a/b  keylocation     none         default
+tank/a/b  pbkdf2iters     350000       -
+tank/a/b  keystatus       available    -`), []byte(`NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    0      default`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	opts := NewFlagOptions(WithExcludeProperties("mountpoint", "keylocation"))
+
+	cmdline, err := pool.CreatePoolCommand(opts)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -O compression=lz4 tank", strings.Join(cmdline, " "))
+
+	cmdline, err = pool.CreateDatasetCommand("tank/a", opts)
+	assert.NoError(err)
+	assert.Equal("zfs create -o compression=zstd -o encryption=aes-256-gcm -o keyformat=passphrase -o pbkdf2iters=350000 tank/a", strings.Join(cmdline, " "))
+
+	// Excluding an encryption-inherited property leaves the encryption root intact
+	cmdline, err = pool.CreateDatasetCommand("tank/a/b", opts)
+	assert.NoError(err)
+	assert.Equal("zfs create tank/a/b", strings.Join(cmdline, " "))
+	assert.Empty(Validate(pools))
+
+	// Exclusion takes precedence over inclusion
+	opts = NewFlagOptions(WithIncludeProperties("compression", "mountpoint"), WithExcludeProperties("mountpoint"))
+	cmdline, err = pool.CreatePoolCommand(opts)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -O compression=lz4 tank", strings.Join(cmdline, " "))
+}
+
+func TestOnlyLocal(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME    PROPERTY        VALUE        SOURCE
+tank    type            filesystem   -
+tank    compression     lz4          local
+tank    utf8only        on           -
+tank    atime           off          received
+tank/a  type            filesystem   -
+tank/a  encryptionroot  tank/a       -
+tank/a  encryption      aes-256-gcm  -
+tank/a  keyformat       passphrase   -
+tank/a  keylocation     prompt       local
+tank/a  pbkdf2iters     350000       -
+tank/a  keystatus       available    -
+tank/a  compression     lz4          inherited from tank
+tank/a  recordsize      1M           local`), []byte(`NAME  PROPERTY   VALUE     SOURCE
+tank  ashift     12        local
+tank  autotrim   off       default
+tank  feature@a  active    local
+tank  feature@e  enabled   local`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	cmdline, err := pool.CreatePoolCommand(NewFlagOptions(WithOnlyLocal(true), WithMinimalFeatures(true)))
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o ashift=12 -o feature@a=enabled -O compression=lz4 tank", strings.Join(cmdline, " "))
+
+	cmdline, err = pool.CreatePoolCommand(NewFlagOptions(WithOnlyLocal(true)))
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o ashift=12 -o feature@a=enabled -o feature@e=enabled -O compression=lz4 tank", strings.Join(cmdline, " "))
+
+	cmdline, err = pool.CreateDatasetCommand("tank/a", NewFlagOptions(WithOnlyLocal(true)))
+	assert.NoError(err)
+	assert.Equal("zfs create -o encryption=aes-256-gcm -o keyformat=passphrase -o keylocation=prompt -o pbkdf2iters=350000 -o recordsize=1M tank/a", strings.Join(cmdline, " "))
+}
+
+func TestKeyLocations(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME    PROPERTY        VALUE                SOURCE
+tank    type            filesystem           -
+tank/a  type            filesystem           -
+tank/a  encryptionroot  tank/a               -
+tank/a  encryption      aes-256-gcm          -
+tank/a  keyformat       passphrase           -
+tank/a  keylocation     prompt               local
+tank/a  keystatus       available            -
+tank/b  type            filesystem           -
+tank/b  encryptionroot  tank/b               -
+tank/b  encryption      aes-256-gcm          -
+tank/b  keyformat       raw                  -
+tank/b  keylocation     file:///etc/b.key    local
+tank/b  keystatus       available            -`), []byte(`NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    0      default`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	keylocation := func(name string, opts *FlagOptions) string {
+		cmdline, err := pool.CreateDatasetCommand(name, opts)
+		assert.NoError(err)
+		for _, arg := range cmdline {
+			if strings.HasPrefix(arg, "keylocation=") {
+				return strings.TrimPrefix(arg, "keylocation=")
+			}
+		}
+		return ""
+	}
+
+	assert.Equal("prompt", keylocation("tank/a", nil))
+
+	// The default only replaces prompt
+	opts := NewFlagOptions(WithKeyLocation("", "file:///root/key"))
+	assert.Equal("file:///root/key", keylocation("tank/a", opts))
+	assert.Equal("file:///etc/b.key", keylocation("tank/b", opts))
+
+	opts = NewFlagOptions(WithKeyLocation("", "file:///root/key"), WithKeyLocation("tank/a", "file:///root/a.key"), WithKeyLocation("tank/b", "https://keys/b"))
+	assert.Equal("file:///root/a.key", keylocation("tank/a", opts))
+	assert.Equal("https://keys/b", keylocation("tank/b", opts))
+}
+
+func TestLoadKeyCommand(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME         PROPERTY        VALUE       SOURCE
+bar          type            filesystem  -
+bar/foo      type            filesystem  -
+bar/foo      encryptionroot  bar/foo     -
+bar/foo      encryption      foobar      -
+bar/foo      keystatus       available   -
+bar/foo      keylocation     prompt      local
+bar/foo      keyformat       passphrase  -
+bar/foo      pbkdf2iters     342K        -
+bar/foo/bar  type            filesystem  -
+bar/foo/bar  encryptionroot  bar/foo     -
+bar/foo/bar  encryption      foobar      -
+bar/foo/bar  keylocation     none        default
+bar/foo/bar  keyformat       passphrase  -
+bar/foo/bar  pbkdf2iters     342K        -
+bar/foo/bar  keystatus       available   -`), []byte(`NAME  PROPERTY  VALUE  SOURCE
+bar   ashift    0      default`))
+	assert.NoError(err)
+	pool := pools["bar"]
+
+	cmdline, err := pool.LoadKeyCommand("bar/foo")
+	assert.NoError(err)
+	assert.Equal([]string{"zfs", "load-key", "bar/foo"}, cmdline)
+
+	_, err = pool.LoadKeyCommand("bar/foo/bar")
+	assert.EqualError(err, "bar/foo/bar is not an encryption root")
+	_, err = pool.LoadKeyCommand("bar/gone")
+	assert.EqualError(err, "dataset bar/gone not found in pool bar")
+
+	commands, err := pool.AllCommands(NewFlagOptions(WithLoadKeys(true)))
+	assert.NoError(err)
+	var kinds []CommandKind
+	for _, c := range commands {
+		kinds = append(kinds, c.Kind)
+	}
+	assert.Equal([]CommandKind{CommandPool, CommandDataset, CommandDataset}, kinds)
+
+	names := []string{"bar", "bar/foo", "bar/foo/bar"}
+	commands, err = pool.ImportCommands(names, NewFlagOptions(WithLoadKeys(true)))
+	assert.NoError(err)
+	assert.Len(commands, 2)
+	assert.Equal(CommandImport, commands[0].Kind)
+	assert.Equal([]string{"zpool", "import", "bar"}, commands[0].Argv)
+	assert.Equal(Command{Kind: CommandLoadKey, Target: "bar/foo", Argv: []string{"zfs", "load-key", "bar/foo"}}, commands[1])
+
+	commands, err = pool.ImportCommands(names, nil)
+	assert.NoError(err)
+	assert.Len(commands, 1)
+}
+
+func TestChangeKeyCommand(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME      PROPERTY        VALUE              SOURCE
+tank      type            filesystem         -
+tank/e    type            filesystem         -
+tank/e    encryptionroot  tank/e             -
+tank/e    encryption      aes-256-gcm        -
+tank/e    keyformat       passphrase         -
+tank/e    keylocation     prompt             local
+tank/e    pbkdf2iters     350000             -
+tank/e    keystatus       available          -
+tank/e/a  type            filesystem         -
+tank/e/a  encryptionroot  tank/e             -
+tank/e/a  encryption      aes-256-gcm        -
+tank/e/a  keyformat       passphrase         -
+tank/e/a  keylocation     none               default
+tank/e/a  pbkdf2iters     350000             -
+tank/e/a  keystatus       available          -
+tank/e/k  type            filesystem         -
+tank/e/k  encryptionroot  tank/e             -
+tank/e/k  encryption      aes-256-gcm        -
+tank/e/k  keyformat       raw                -
+tank/e/k  keylocation     file:///etc/k.key  local
+tank/e/k  pbkdf2iters     350000             -
+tank/e/k  keystatus       available          -`), []byte(`NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    0      default`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	cmdline, err := pool.ChangeKeyCommand("tank/e/a")
+	assert.NoError(err)
+	assert.Nil(cmdline)
+	cmdline, err = pool.ChangeKeyCommand("tank/e")
+	assert.NoError(err)
+	assert.Nil(cmdline)
+
+	// The key is changed after creation, rather than passed to zfs create
+	commands, err := pool.CommandsFor("tank/e/k", nil)
+	assert.NoError(err)
+	assert.Equal([]Command{
+		{Kind: CommandDataset, Target: "tank/e/k", Argv: []string{"zfs", "create", "tank/e/k"}},
+		{Kind: CommandChangeKey, Target: "tank/e/k", Argv: []string{"zfs", "change-key", "-o", "keyformat=raw", "-o", "keylocation=file:///etc/k.key", "tank/e/k"}},
+	}, commands)
+}
+
+func TestRawKeyformat(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME    PROPERTY        VALUE                SOURCE
+tank    type            filesystem           -
+tank/r  type            filesystem           -
+tank/r  encryptionroot  tank/r               -
+tank/r  encryption      aes-256-gcm          -
+tank/r  keyformat       raw                  -
+tank/r  keylocation     file:///etc/r.key    local
+tank/r  pbkdf2iters     0                    -
+tank/r  keystatus       available            -
+tank/h  type            filesystem           -
+tank/h  encryptionroot  tank/h               -
+tank/h  encryption      aes-256-gcm          -
+tank/h  keyformat       hex                  -
+tank/h  keylocation     file:///etc/h.key    local
+tank/h  pbkdf2iters     0                    -
+tank/h  keystatus       available            -`), []byte(`NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    0      default`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	cmdline, err := pool.CreateDatasetCommand("tank/r", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o encryption=aes-256-gcm -o keyformat=raw -o keylocation=file:///etc/r.key tank/r", strings.Join(cmdline, " "))
+
+	cmdline, err = pool.CreateDatasetCommand("tank/h", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o encryption=aes-256-gcm -o keyformat=hex -o keylocation=file:///etc/h.key tank/h", strings.Join(cmdline, " "))
+}
+
+func TestUnorderedInput(t *testing.T) {
+	assert := require.New(t)
+
+	ordered := `NAME          PROPERTY     VALUE       SOURCE
+tank          type         filesystem  -
+tank          compression  lz4         local
+tank@s        type         snapshot    -
+tank/a        type         filesystem  -
+tank/a        compression  lz4         inherited from tank
+tank/a/x      type         filesystem  -
+tank/a/x      atime        off         local
+tank/a/x@s    type         snapshot    -
+tank/b        type         filesystem  -
+other         type         filesystem  -
+other/c       type         filesystem  -
+other/c       atime        off         local`
+
+	reorder := func(s string) string {
+		r, err := orderGetAll(strings.NewReader(s))
+		assert.NoError(err)
+		b, err := io.ReadAll(r)
+		assert.NoError(err)
+		return string(b)
+	}
+	assert.Equal(ordered, reorder(ordered))
+
+	shuffled := `NAME          PROPERTY     VALUE       SOURCE
+tank/a/x      atime        off         local
+other/c       type         filesystem  -
+tank/a/x@s    type         snapshot    -
+tank/a        compression  lz4         inherited from tank
+
+tank/b        type         filesystem  -
+tank/a/x      type         filesystem  -
+tank@s        type         snapshot    -
+tank          type         filesystem  -
+tank/a        type         filesystem  -
+other         type         filesystem  -
+other/c       atime        off         local
+tank          compression  lz4         local`
+
+	reordered := reorder(shuffled)
+	assert.Equal(`NAME          PROPERTY     VALUE       SOURCE
+tank          type         filesystem  -
+tank          compression  lz4         local
+tank@s        type         snapshot    -
+tank/a        compression  lz4         inherited from tank
+tank/a        type         filesystem  -
+tank/a/x      atime        off         local
+tank/a/x      type         filesystem  -
+tank/a/x@s    type         snapshot    -
+tank/b        type         filesystem  -
+other         type         filesystem  -
+other/c       type         filesystem  -
+other/c       atime        off         local`, reordered)
+
+	pools, err := ParseProperties([]byte(shuffled), []byte(`NAME   PROPERTY  VALUE  SOURCE
+tank   ashift    0      default
+other  ashift    0      default`))
+	assert.NoError(err)
+
+	commands, err := pools["tank"].AllCommands(&FlagOptions{Snapshots: true})
+	assert.NoError(err)
+	var targets []string
+	for _, c := range commands {
+		targets = append(targets, c.Target)
+	}
+	assert.Equal([]string{"tank", "tank@s", "tank/a", "tank/a/x", "tank/a/x@s", "tank/b"}, targets)
+
+	// Tab-separated input is reordered the same way
+	tabs := "tank/a\ttype\tfilesystem\t-\ntank\ttype\tfilesystem\t-"
+	assert.Equal("tank\ttype\tfilesystem\t-\ntank/a\ttype\tfilesystem\t-", reorder(tabs))
+}
+
+func TestTabSeparated(t *testing.T) {
+	assert := require.New(t)
+
+	poolInput := []byte("tank\tcomment\tprimary backup pool\tlocal\n" +
+		"tank\tfeature@a\tactive\tlocal\n")
+
+	input := []byte("tank\ttype\tfilesystem\t-\n" +
+		"tank\tcompression\tlz4\tlocal\n" +
+		"tank\torg:note\tkeep  local\tlocal\n" +
+		"tank/home\ttype\tfilesystem\t-\n" +
+		"tank/home\tcompression\tlz4\tinherited from tank\n" +
+		"tank/home\torg:note\tkeep  local\tinherited from tank\n" +
+		"tank/home\tatime\toff\tlocal\n")
+
+	poolProps, err := zpoolParse(poolInput)
+	assert.NoError(err)
+
+	pools, err := parseGetAll(input, poolProps)
+	assert.EqualError(err, "end of input")
+
+	cmdline, err := pools["tank"].CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"zpool", "create", "-d",
+		"-o", "feature@a=enabled",
+		"-O", "compression=lz4",
+		"-O", "org:note=keep  local",
+		"tank",
+	}, cmdline)
+	assert.Equal([][]string{{"zpool", "set", "comment=primary backup pool", "tank"}}, pools["tank"].SetPropertyCommands(nil))
+
+	cmdline, err = pools["tank"].CreateDatasetCommand("tank/home", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o atime=off tank/home", strings.Join(cmdline, " "))
+
+	_, err = parseGetAll([]byte("tank\ttype\tfilesystem\t-\ntank\tbogus\n"), poolProps)
+	assert.EqualError(err, "line 2: unparseable input: tank\tbogus")
+
+	_, err = zpoolParse([]byte("tank\tashift\t12\tlocal\ntank\tbogus\n"))
+	assert.EqualError(err, "expected 4 tab-separated fields: tank\tbogus")
+}
+
+func TestReceivedProperties(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME         PROPERTY     VALUE       SOURCE
+tank         type         filesystem  -
+tank/backup  type         filesystem  -
+tank/backup  compression  zstd        received
+tank/backup  atime        off         local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	assert.Equal(PropertyReceived, pools["tank"].Datasets.Index["tank/backup"].Properties["compression"].Source.Location)
+
+	cmdline, err := pools["tank"].CreateDatasetCommand("tank/backup", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o atime=off -o compression=zstd tank/backup", strings.Join(cmdline, " "))
+
+	cmdline, err = pools["tank"].CreateDatasetCommand("tank/backup", &FlagOptions{IncludeReceived: false})
+	assert.NoError(err)
+	assert.Equal("zfs create -o atime=off tank/backup", strings.Join(cmdline, " "))
+}
+
+func TestPartialInput(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	input := []byte(`NAME          PROPERTY     VALUE       SOURCE
+tank          type         filesystem  -
+tank          atime        off         local
+tank/a/b      type         filesystem  -
+tank/a/b      compression  zstd        inherited from tank/a
+tank/a/b      atime        off         inherited from tank
+tank/a/b@s    type         snapshot    -
+tank/a/b@s    compression  zstd        inherited from tank/a`)
+
+	_, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "line 5: tank/a/b inherits from tank/a, which is missing from the input; the capture may be incomplete or out of order")
+
+	p := &parser{partialInput: true}
+	pools, err := p.parseGetAll(bytes.NewReader(input), map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	assert.Equal([]string{
+		"tank/a/b inherits compression from tank/a, which is not in the input; treating it as local",
+		"tank/a/b@s inherits compression from tank/a, which is not in the input; treating it as local",
+	}, warnings)
+
+	prop := pools["tank"].Datasets.Index["tank/a/b"].Properties["compression"]
+	assert.Equal(PropertyInherited, prop.Source.Location)
+	assert.Equal("tank/a", prop.Source.Parent)
+	assert.Nil(prop.Source.Inherited)
+	assert.Equal("zstd", prop.Value())
+
+	cmdline, err := pools["tank"].CreateDatasetCommand("tank/a/b", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o compression=zstd tank/a/b", strings.Join(cmdline, " "))
+}
+
+func TestMissingAncestor(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	input := []byte(`NAME        PROPERTY  VALUE       SOURCE
+tank        type      filesystem  -
+tank        xxup      a           -
+tank/a/b    type      filesystem  -
+tank/a/b    xxup      a           -
+tank/a/c    type      filesystem  -
+tank/a/c    xxup      a           -`)
+
+	_, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "tank/a/b descends from tank/a, which is missing from the input; the capture may be incomplete or out of order")
+	assert.Empty(warnings)
+
+	p := &parser{continueOnError: true}
+	pools, err := p.parseGetAll(bytes.NewReader(input), map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	assert.Equal([]string{
+		"tank/a/b descends from tank/a, which is missing from the input; the capture may be incomplete or out of order; skipping it",
+	}, warnings)
+
+	sets := pools["tank"].Datasets.Index
+	assert.Same(sets["tank"].Properties["xxup"], sets["tank/a/c"].Properties["xxup"].Source.Inherited)
+}
+
+func TestReadonlyInheritance(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME        PROPERTY  VALUE       SOURCE
+tank        type      filesystem  -
+tank        xxup      a           -
+tank        yyup      a           -
+tank/b      type      filesystem  -
+tank/b      yyup      b           -
+tank/b/c    type      filesystem  -
+tank/b/c    xxup      a           -
+tank/b/c    yyup      a           -
+tank/b/c/d  type      filesystem  -
+tank/b/c/d  xxup      a           -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	sets := pools["tank"].Datasets.Index
+
+	// tank/b lacks xxup, so tank/b/c inherits it from two levels up
+	xxup := sets["tank/b/c"].Properties["xxup"]
+	assert.Equal(PropertyInherited, xxup.Source.Location)
+	assert.Equal("tank", xxup.Source.Parent)
+
+	// The nearest ancestor with xxup is now tank/b/c
+	xxup = sets["tank/b/c/d"].Properties["xxup"]
+	assert.Equal(PropertyInherited, xxup.Source.Location)
+	assert.Equal("tank/b/c", xxup.Source.Parent)
+
+	// tank/b has a different yyup, so matching tank doesn't make it inherited
+	assert.Equal(PropertyReadonly, sets["tank/b"].Properties["yyup"].Source.Location)
+	assert.Equal(PropertyReadonly, sets["tank/b/c"].Properties["yyup"].Source.Location)
+
+	cmdline, err := pools["tank"].CreateDatasetCommand("tank/b/c", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o yyup=a tank/b/c", strings.Join(cmdline, " "))
+}
+
+func TestCreateInheritCommands(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME      PROPERTY         VALUE       SOURCE
+tank      type             filesystem  -
+tank      compression      lz4         local
+tank      atime            off         local
+tank      utf8only         on          -
+tank/a    type             filesystem  -
+tank/a    compression      zstd        local
+tank/a    atime            off         inherited from tank
+tank/a    utf8only         on          -
+tank/a/b  type             filesystem  -
+tank/a/b  compression      zstd        inherited from tank/a
+tank/a/b  atime            off         inherited from tank
+tank/a/b  recordsize       128K        default
+tank/a/b  utf8only         on          -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+
+	cmdline, err := pool.CreateDatasetCommand("tank/a", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o compression=zstd tank/a", strings.Join(cmdline, " "))
+
+	// tank/a/b follows the compression set on tank/a rather than the pool default
+	expected := map[string][]string{
+		"tank":     nil,
+		"tank/a":   {"zfs inherit atime tank/a"},
+		"tank/a/b": {"zfs inherit atime tank/a/b", "zfs inherit compression tank/a/b"},
+	}
+	for name, out := range expected {
+		cmdlines, err := pool.CreateInheritCommands(name)
+		assert.NoError(err)
+		var actual []string
+		for _, cmdline := range cmdlines {
+			actual = append(actual, strings.Join(cmdline, " "))
+		}
+		assert.Equal(out, actual, name)
+	}
+
+	_, err = pool.CreateInheritCommands("tank/x")
+	assert.EqualError(err, "dataset tank/x not found in pool tank")
+}
+
+// Generates zfs get all output for a pool of width chains of depth nested
+// datasets, each with properties readonly after creation
+func syntheticGetAll(width, depth int) []byte {
+	var b strings.Builder
+	set := func(name string) {
+		fmt.Fprintf(&b, "%s\ttype\tfilesystem\t-\n", name)
+		fmt.Fprintf(&b, "%s\tcompression\tlz4\tinherited from tank\n", name)
+		for _, prop := range []string{"casesensitivity", "normalization", "utf8only"} {
+			fmt.Fprintf(&b, "%s\t%s\toff\t-\n", name, prop)
+		}
+	}
+	fmt.Fprintf(&b, "tank\ttype\tfilesystem\t-\ntank\tcompression\tlz4\tlocal\n")
+	fmt.Fprintf(&b, "tank\tutf8only\toff\t-\n")
+	for i := 0; i < width; i++ {
+		name := fmt.Sprintf("tank/%d", i)
+		for j := 0; j < depth; j++ {
+			set(name)
+			name = fmt.Sprintf("%s/%d", name, j)
+		}
+	}
+	return []byte(b.String())
+}
+
+// Includes parsing, which fixInheritance completes
+func BenchmarkFixInheritance(b *testing.B) {
+	input := syntheticGetAll(50, 100)
+	for i := 0; i < b.N; i++ {
+		if _, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}}); err != (inputEOF{}) {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseGetAll(b *testing.B) {
+	tabs := syntheticGetAll(50, 100)
+	table := append([]byte("NAME  PROPERTY  VALUE  SOURCE\n"), bytes.ReplaceAll(tabs, []byte{'\t'}, []byte("  "))...)
+
+	for name, input := range map[string][]byte{"tabs": tabs, "table": table} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}}); err != (inputEOF{}) {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME       PROPERTY     VALUE       SOURCE
+tank       type         filesystem  -
+tank       compression  lz4         local
+tank/home  type         filesystem  -
+tank/home  compression  lz4         inherited from tank`), []byte(`NAME  PROPERTY   VALUE   SOURCE
+tank  comment    backup  local`))
+	assert.NoError(err)
+	assert.Len(pools, 1)
+	assert.Len(pools["tank"].Datasets.Ordered, 2)
+
+	cmdline, err := pools["tank"].CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -O compression=lz4 tank", strings.Join(cmdline, " "))
+
+	_, err = ParseProperties([]byte("tank\tbogus\n"), []byte("tank\tcomment\tbackup\tlocal\n"))
+	assert.EqualError(err, "error parsing zfs get all: unexpected header: tank\tbogus")
+}
+
+func TestReservations(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME        PROPERTY        VALUE       SOURCE
+tank        type            filesystem  -
+tank/none   type            filesystem  -
+tank/none   reservation     none        local
+tank/none   refreservation  none        local
+tank/ref    type            filesystem  -
+tank/ref    reservation     none        default
+tank/ref    refreservation  5G          local
+tank/both   type            filesystem  -
+tank/both   reservation     10G         local
+tank/both   refreservation  5G          local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	expected := map[string]string{
+		"tank/none": "zfs create tank/none",
+		"tank/ref":  "zfs create -o refreservation=5G tank/ref",
+		"tank/both": "zfs create -o refreservation=5G -o reservation=10G tank/both",
+	}
+	for name, out := range expected {
+		cmdline, err := pools["tank"].CreateDatasetCommand(name, nil)
+		assert.NoError(err)
+		assert.Equal(out, strings.Join(cmdline, " "), name)
+	}
+}
+
+func TestDefaultValues(t *testing.T) {
+	assert := require.New(t)
+
+	var omitted []string
+	defer func(o func(string, ...interface{})) { Omitf = o }(Omitf)
+	Omitf = func(format string, v ...interface{}) {
+		omitted = append(omitted, fmt.Sprintf(format, v...))
+	}
+
+	input := []byte(`NAME        PROPERTY  VALUE       SOURCE
+tank        type      filesystem  -
+tank/a      type      filesystem  -
+tank/a      quota     none        local
+tank/a      refquota  20G         local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	cmdline, err := pools["tank"].CreateDatasetCommand("tank/a", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o refquota=20G tank/a", strings.Join(cmdline, " "))
+	assert.Contains(omitted, "tank/a: omitting quota (default value)")
+}
+
+func TestNonDefaultProperties(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME    PROPERTY     VALUE       SOURCE
+tank    type         filesystem  -
+tank    compression  lz4         local
+tank    atime        on          default
+tank    used         1G          -
+tank    utf8only     off         -
+tank/a  type         filesystem  -
+tank/a  compression  lz4         inherited from tank
+tank/a  quota        none        local
+tank/a  recordsize   1M          received`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	names := func(props []*Property) (names []string) {
+		for _, p := range props {
+			names = append(names, p.Name+"="+p.Value()+" "+p.Source.String())
+		}
+		return names
+	}
+	assert.Equal([]string{"compression=lz4 local"}, names(pools["tank"].Datasets.Index["tank"].NonDefaultProperties()))
+	assert.Equal([]string{"compression=lz4 inherited from tank", "recordsize=1M received"}, names(pools["tank"].Datasets.Index["tank/a"].NonDefaultProperties()))
+}
+
+func TestUserProperties(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME    PROPERTY            VALUE               SOURCE
+tank    type                filesystem          -
+tank    com.example:backup  daily               local
+tank/a  type                filesystem          -
+tank/a  com.example:backup  daily               inherited from tank
+tank/a  org.test:note       it's $HOME & "more"  local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+
+	backup := pool.Datasets.Index["tank/a"].Properties["com.example:backup"]
+	assert.Equal(PropertyInherited, backup.Source.Location)
+	assert.Same(pool.Datasets.Index["tank"].Properties["com.example:backup"], backup.Source.Inherited)
+	assert.Equal(`it's $HOME & "more"`, pool.Datasets.Index["tank/a"].Properties["org.test:note"].Value())
+
+	c, err := pool.DatasetCommand("tank/a", nil)
+	assert.NoError(err)
+	assert.Equal(`zfs create -o 'org.test:note=it'"'"'s $HOME & "more"' tank/a`, c.Oneline())
+
+	cmdline, err := pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -O com.example:backup=daily tank", strings.Join(cmdline, " "))
+
+	opts := NewFlagOptions(WithNoUserProperties(true))
+	cmdline, err = pool.CreateDatasetCommand("tank/a", opts)
+	assert.NoError(err)
+	assert.Equal("zfs create tank/a", strings.Join(cmdline, " "))
+	cmdline, err = pool.CreatePoolCommand(opts)
+	assert.NoError(err)
+	assert.Equal("zpool create -d tank", strings.Join(cmdline, " "))
+}
+
+func TestReadonlyWarning(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	input := []byte(`NAME      PROPERTY  VALUE       SOURCE
+tank      type      filesystem  -
+tank      readonly  on          temporary
+tank/a    type      filesystem  -
+tank/a    readonly  on          temporary
+back      type      filesystem  -
+back      readonly  off         default
+back/a    type      filesystem  -
+back/a    readonly  on          local
+back/a/b  type      filesystem  -
+back/a/b  readonly  on          inherited from back/a`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}, "back": {}})
+	assert.EqualError(err, "end of input")
+
+	for _, pool := range []*Pool{pools["tank"], pools["back"]} {
+		cmdline, err := pool.CreatePoolCommand(nil)
+		assert.NoError(err)
+		assert.Equal([]string{"zpool", "create", "-d", pool.Name}, cmdline)
+		for _, d := range pool.Datasets.Ordered[1:] {
+			cmdline, err := pool.CreateDatasetCommand(d.Name, nil)
+			assert.NoError(err)
+			assert.Equal([]string{"zfs", "create", d.Name}, cmdline)
+		}
+	}
+	assert.Equal([]string{
+		"tank has readonly=on (temporary), which is not reproduced; it will be created read-write",
+		"back/a has readonly=on (local), which is not reproduced; it will be created read-write",
+	}, warnings)
+}
+
+func TestSetPropertyCommands(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME  PROPERTY  VALUE       SOURCE
+tank  type      filesystem  -`), []byte(`NAME  PROPERTY    VALUE  SOURCE
+tank  ashift      12     local
+tank  autotrim    on     local
+tank  autoexpand  off    default`))
+	assert.NoError(err)
+	pool := pools["tank"]
+
+	cmdline, err := pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o ashift=12 tank", strings.Join(cmdline, " "))
+	assert.Equal([][]string{{"zpool", "set", "autotrim=on", "tank"}}, pool.SetPropertyCommands(nil))
+
+	commands, err := pool.CommandsFor("tank", nil)
+	assert.NoError(err)
+	assert.Equal([]Command{
+		{Kind: CommandPool, Target: "tank", Argv: cmdline},
+		{Kind: CommandSet, Target: "tank", Argv: []string{"zpool", "set", "autotrim=on", "tank"}},
+	}, commands)
+
+	assert.Empty(pool.SetPropertyCommands(NewFlagOptions(WithExcludeProperties("autotrim"))))
+}
+
+func TestFeatureDependencies(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME  PROPERTY  VALUE       SOURCE
+tank  type      filesystem  -`), []byte(`NAME  PROPERTY                    VALUE    SOURCE
+tank  ashift                      12       local
+tank  feature@async_destroy       enabled  local
+tank  feature@bookmark_v2         enabled  local
+tank  feature@bookmarks           enabled  local
+tank  feature@encryption          active   local
+tank  feature@extensible_dataset  active   local
+tank  feature@zpool_checkpoint    enabled  local`))
+	assert.NoError(err)
+
+	cmdline, err := pools["tank"].CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"zpool", "create", "-d",
+		"-o", "ashift=12",
+		"-o", "feature@async_destroy=enabled",
+		"-o", "feature@extensible_dataset=enabled",
+		"-o", "feature@bookmarks=enabled",
+		"-o", "feature@bookmark_v2=enabled",
+		"-o", "feature@encryption=enabled",
+		"-o", "feature@zpool_checkpoint=enabled",
+		"tank",
+	}, cmdline)
+}
+
+func TestMultihost(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings, omitted []string
+	defer func(w, o func(string, ...interface{})) { Warnf, Omitf = w, o }(Warnf, Omitf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+	Omitf = func(format string, v ...interface{}) {
+		omitted = append(omitted, fmt.Sprintf(format, v...))
+	}
+
+	pools, err := ParseProperties([]byte(`NAME    PROPERTY  VALUE       SOURCE
+shared  type      filesystem  -
+tank    type      filesystem  -`), []byte(`NAME    PROPERTY   VALUE  SOURCE
+shared  multihost  on     local
+tank    multihost  off    default`))
+	assert.NoError(err)
+
+	commands, err := pools["shared"].CommandsFor("shared", nil)
+	assert.NoError(err)
+	assert.Equal([]Command{
+		{Kind: CommandPool, Target: "shared", Argv: []string{"zpool", "create", "-d", "shared"}},
+		{Kind: CommandSet, Target: "shared", Argv: []string{"zpool", "set", "multihost=on", "shared"}},
+	}, commands)
+	assert.Equal([]string{"shared has multihost=on; /etc/hostid must match the hostid of the host that imported it, and be unique among hosts sharing its devices"}, warnings)
+	assert.Contains(omitted, "shared: deferring multihost to zpool set (depends on the hostid, see zgenhostid)")
+
+	assert.Empty(pools["tank"].SetPropertyCommands(nil))
+	assert.Len(warnings, 1)
+}
+
+func TestFailmode(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME  PROPERTY  VALUE       SOURCE
+tank  type      filesystem  -
+wait  type      filesystem  -`), []byte(`NAME  PROPERTY  VALUE     SOURCE
+tank  ashift    12        local
+tank  failmode  continue  local
+wait  failmode  wait      default`))
+	assert.NoError(err)
+
+	commands, err := pools["tank"].CommandsFor("tank", nil)
+	assert.NoError(err)
+	assert.Len(commands, 2)
+	assert.Equal("zpool create -d -o ashift=12 tank", commands[0].Oneline())
+	assert.Equal("zpool set failmode=continue tank", commands[1].Oneline())
+
+	commands, err = pools["wait"].CommandsFor("wait", nil)
+	assert.NoError(err)
+	assert.Len(commands, 1)
+}
+
+func TestReservedCharacters(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME                  PROPERTY        VALUE       SOURCE
+tank                  type            filesystem  -
+tank/vm-100:disk0     type            volume      -
+tank/vm-100:disk0     volsize         10G         local
+tank/vm-100:disk0     volblocksize    16K         -
+tank/vm-100:disk0     refreservation  none        default
+tank/a.b.c            type            filesystem  -
+tank/a.b.c            atime           off         local
+tank/a.b.c/d_e        type            filesystem  -
+tank/a.b.c/d_e        atime           off         inherited from tank/a.b.c
+tank/a.b.c@auto:1.0   type            snapshot    -
+tank/a.b.c@auto:1.0   createtxg       10          -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+
+	atime := pool.Datasets.Index["tank/a.b.c/d_e"].Properties["atime"]
+	assert.Same(pool.Datasets.Index["tank/a.b.c"].Properties["atime"], atime.Source.Inherited)
+	assert.Len(pool.Datasets.Index["tank/a.b.c"].Snapshots, 1)
+
+	opts := NewFlagOptions(WithSnapshots(true))
+	var actual []string
+	for _, name := range []string{"tank/vm-100:disk0", "tank/a.b.c"} {
+		commands, err := pool.CommandsFor(name, opts)
+		assert.NoError(err)
+		for _, c := range commands {
+			actual = append(actual, c.Oneline(), c.Format(QuoteFish, false))
+		}
+	}
+	assert.Equal([]string{
+		"zfs create -s -V 10G -b 16K tank/vm-100:disk0",
+		"zfs create -s -V 10G -b 16K tank/vm-100:disk0",
+		"zfs create -o atime=off tank/a.b.c",
+		"zfs create -o atime=off tank/a.b.c",
+		"zfs snapshot tank/a.b.c@auto:1.0",
+		"zfs snapshot tank/a.b.c@auto:1.0",
+	}, actual)
+
+	// Names may contain spaces, which only zfs get -H output can separate
+	p := &parser{tabs: true}
+	pools, err = p.parseGetAll(bytes.NewReader([]byte("tank\ttype\tfilesystem\t-\n"+
+		"tank/my data\ttype\tfilesystem\t-\n"+
+		"tank/my data\tatime\toff\tlocal\n"+
+		"tank/my data/x\ttype\tfilesystem\t-\n"+
+		"tank/my data/x\tatime\toff\tinherited from tank/my data\n")), map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	c, err := pools["tank"].DatasetCommand("tank/my data/x", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create 'tank/my data/x'", c.Oneline())
+	c, err = pools["tank"].DatasetCommand("tank/my data", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o atime=off 'tank/my data'", c.Oneline())
+}
+
+func TestShareProperties(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME          PROPERTY  VALUE                                                 SOURCE
+tank          type      filesystem                                            -
+tank/export   type      filesystem                                            -
+tank/export   sharenfs  rw=@10.0.0.0/24,no_root_squash,sec=sys:krb5           local
+tank/export   sharesmb  name=media share,guest_ok=y                           local
+tank/export/a type      filesystem                                            -
+tank/export/a sharenfs  rw=@10.0.0.0/24,no_root_squash,sec=sys:krb5           inherited from tank/export
+tank/export/a sharesmb  off                                                   local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+
+	assert.Equal("name=media share,guest_ok=y", pool.Datasets.Index["tank/export"].Properties["sharesmb"].Value())
+
+	c, err := pool.DatasetCommand("tank/export", nil)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"zfs", "create",
+		"-o", "sharenfs=rw=@10.0.0.0/24,no_root_squash,sec=sys:krb5",
+		"-o", "sharesmb=name=media share,guest_ok=y",
+		"tank/export",
+	}, c.Argv)
+	assert.Equal("zfs create -o sharenfs=rw=@10.0.0.0/24,no_root_squash,sec=sys:krb5 -o 'sharesmb=name=media share,guest_ok=y' tank/export", c.Oneline())
+	assert.Equal("zfs create -o sharenfs=rw=@10.0.0.0/24,no_root_squash,sec=sys:krb5 -o 'sharesmb=name=media share,guest_ok=y' tank/export", c.Format(QuoteFish, false))
+
+	c, err = pool.DatasetCommand("tank/export/a", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o sharesmb=off tank/export/a", c.Oneline())
+
+	c, err = pool.DatasetCommand("tank/export", NewFlagOptions(WithNoShares(true)))
+	assert.NoError(err)
+	assert.Equal("zfs create tank/export", c.Oneline())
+}
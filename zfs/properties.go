@@ -0,0 +1,191 @@
+package zfs
+
+// Differentiate truly readonly status flags from onlyAtCreation flags
+var statusProperties = map[string]struct{}{
+	"type":                 {},
+	"creation":             {},
+	"used":                 {},
+	"available":            {},
+	"referenced":           {},
+	"rekeydate":            {},
+	"compressratio":        {},
+	"mounted":              {},
+	"origin":               {},
+	"receive_resume_token": {},
+	"version":              {},
+	"defer_destroy":        {},
+	"userrefs":             {},
+	"usedbysnapshots":      {},
+	"usedbydataset":        {},
+	"usedbychildren":       {},
+	"usedbyrefreservation": {},
+	"refcompressratio":     {},
+	"written":              {},
+	"clones":               {},
+	"logicalused":          {},
+	"logicalreferenced":    {},
+	"encryptionroot":       {},
+	"keystatus":            {},
+
+	"size":          {},
+	"capacity":      {},
+	"health":        {},
+	"dedupratio":    {},
+	"free":          {},
+	"allocated":     {},
+	"expandsize":    {},
+	"freeing":       {},
+	"fragmentation": {},
+	"leaked":        {},
+	"checkpoint":    {},
+}
+
+// Properties that do not appear readonly, but should not be included in output
+var ignoreProperties = map[string]struct{}{
+	"readonly": {}, // Can only be set during import
+}
+
+// Rows of zpool get all that report on a pool rather than configure it,
+// skipped whatever their source
+var poolInfoProperties = map[string]struct{}{
+	"guid":              {},
+	"load_guid":         {},
+	"bcloneused":        {},
+	"bclonesaved":       {},
+	"bcloneratio":       {},
+	"dedup_table_size":  {},
+	"dedupcached":       {},
+	"last_scrubbed_txg": {},
+}
+
+// Prefix of the rows zpool get all lists for features of a pool that the
+// running zpool does not support, valued inactive or readonly, the latter for
+// readonly-compatible features that are active
+const unsupportedFeaturePrefix = "unsupported@"
+
+// Pool properties set with zpool set once the pool exists, rather than as
+// zpool create -o
+var postCreateProperties = map[string]struct{}{
+	"comment":     {},
+	"autotrim":    {},
+	"autoexpand":  {},
+	"autoreplace": {},
+	// Multi-modifier protection, which depends on the hostid
+	"multihost": {},
+
+	// Enumerated operational properties
+	"failmode":      {},
+	"listsnapshots": {},
+	"delegation":    {},
+}
+
+// Features that other features require to be enabled first, by name without
+// the feature@ prefix. Features missing here are treated as independent.
+var featureDependencies = map[string][]string{
+	"hole_birth":          {"enabled_txg"},
+	"bookmarks":           {"extensible_dataset"},
+	"filesystem_limits":   {"extensible_dataset"},
+	"large_blocks":        {"extensible_dataset"},
+	"large_dnode":         {"extensible_dataset"},
+	"sha512":              {"extensible_dataset"},
+	"skein":               {"extensible_dataset"},
+	"edonr":               {"extensible_dataset"},
+	"blake3":              {"extensible_dataset"},
+	"userobj_accounting":  {"extensible_dataset"},
+	"project_quota":       {"extensible_dataset"},
+	"bookmark_v2":         {"bookmarks", "extensible_dataset"},
+	"bookmark_written":    {"bookmark_v2", "bookmarks", "extensible_dataset"},
+	"encryption":          {"bookmark_v2", "extensible_dataset"},
+	"redaction_bookmarks": {"bookmarks", "extensible_dataset"},
+	"redacted_datasets":   {"extensible_dataset"},
+	"obsolete_counts":     {"device_removal"},
+	"log_spacemap":        {"spacemap_v2"},
+	"livelist":            {"extensible_dataset"},
+	"zstd_compress":       {"extensible_dataset"},
+	"zilsaxattr":          {"extensible_dataset"},
+}
+
+// Release of OpenZFS that first supported each feature, as major and minor,
+// by name without the feature@ prefix. Older features are left out.
+var featureVersions = map[string][2]int{
+	"allocation_classes":  {0, 8},
+	"bookmark_v2":         {0, 8},
+	"device_removal":      {0, 8},
+	"encryption":          {0, 8},
+	"obsolete_counts":     {0, 8},
+	"project_quota":       {0, 8},
+	"resilver_defer":      {0, 8},
+	"spacemap_v2":         {0, 8},
+	"zpool_checkpoint":    {0, 8},
+	"bookmark_written":    {2, 0},
+	"device_rebuild":      {2, 0},
+	"livelist":            {2, 0},
+	"log_spacemap":        {2, 0},
+	"redacted_datasets":   {2, 0},
+	"redaction_bookmarks": {2, 0},
+	"zstd_compress":       {2, 0},
+	"draid":               {2, 1},
+	"blake3":              {2, 2},
+	"block_cloning":       {2, 2},
+	"head_errlog":         {2, 2},
+	"vdev_zaps_v2":        {2, 2},
+	"zilsaxattr":          {2, 2},
+	"fast_dedup":          {2, 3},
+	"large_microzap":      {2, 3},
+	"longname":            {2, 3},
+	"raidz_expansion":     {2, 3},
+}
+
+// Volume properties given to zfs create as -V and -b rather than -o
+var volumeProperties = map[string]struct{}{
+	"volsize":      {},
+	"volblocksize": {},
+}
+
+// Defaults of properties that are not inherited, so that setting the default
+// locally is the same as leaving it unset
+var defaultValues = map[string]string{
+	"reservation":      "none",
+	"refreservation":   "none",
+	"quota":            "none",
+	"refquota":         "none",
+	"filesystem_limit": "none",
+	"snapshot_limit":   "none",
+}
+
+// Settable properties that children don't inherit
+var uninheritableProperties = map[string]struct{}{
+	"reservation":      {},
+	"refreservation":   {},
+	"quota":            {},
+	"refquota":         {},
+	"filesystem_limit": {},
+	"snapshot_limit":   {},
+	"canmount":         {},
+	"volsize":          {},
+}
+
+var encryptionRoot = "encryptionroot"
+
+// Properties that inherit from encryptionroot rather than parent
+// Note that encryptionLocalProperties overlaps with this set
+var encryptionInheritedProperties = map[string]struct{}{
+	"encryptionroot": {},
+	"encryption":     {},
+	"keylocation":    {}, // This one appears to be "none, local" on child datasets, but we treat it like the others
+	"keyformat":      {},
+	"pbkdf2iters":    {},
+	"keystatus":      {},
+}
+
+// Properties that may differ from encryptionroot
+var encryptionLocalProperties = map[string]struct{}{
+	"encryption": {},
+}
+
+// Properties zfs change-key may give an encrypted child, so that they differ
+// from its encryptionroot
+var encryptionKeyProperties = map[string]struct{}{
+	"keyformat":   {},
+	"keylocation": {},
+}
@@ -0,0 +1,85 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// CommandRunner executes a command and returns its standard output. Run may
+// be called concurrently.
+type CommandRunner interface {
+	Run(name string, args ...string) ([]byte, error)
+}
+
+// StreamRunner is a CommandRunner that can also return the standard output of
+// a command as it is written, so that it need not be held in memory at once
+type StreamRunner interface {
+	CommandRunner
+	// Close of the returned reader waits for the command, returning the error
+	// Run would have
+	Stream(name string, args ...string) (io.ReadCloser, error)
+}
+
+type execRunner struct {
+	ctx context.Context
+}
+
+func (r execRunner) Run(name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(r.ctx, name, args...).Output()
+}
+
+func (r execRunner) Stream(name string, args ...string) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(r.ctx, name, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	c := &commandReader{ReadCloser: stdout, cmd: cmd}
+	cmd.Stderr = &c.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type commandReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+}
+
+// Closing the pipe first keeps a command blocked on writing output that is no
+// longer read from hanging Wait
+func (c *commandReader) Close() error {
+	c.ReadCloser.Close()
+	err := c.cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitErr.Stderr = c.stderr.Bytes()
+	}
+	return err
+}
+
+// Returns the output of a command as it is written if r is a StreamRunner, or
+// otherwise once it exits
+func streamCommand(r CommandRunner, name string, args ...string) (io.ReadCloser, error) {
+	if s, ok := r.(StreamRunner); ok {
+		return s.Stream(name, args...)
+	}
+	b, err := r.Run(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// ExecRunner runs commands on this host via os/exec, killing them if ctx is done
+func ExecRunner(ctx context.Context) CommandRunner {
+	return execRunner{ctx: ctx}
+}
+
+// DefaultRunner runs commands on this host via os/exec
+var DefaultRunner = ExecRunner(context.Background())
@@ -0,0 +1,242 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Returns canned output keyed by the full command line
+type fakeRunner map[string]string
+
+func (f fakeRunner) Run(name string, args ...string) ([]byte, error) {
+	cmdline := strings.Join(append([]string{name}, args...), " ")
+	out, ok := f[cmdline]
+	if !ok {
+		return nil, fmt.Errorf("unexpected command: %s", cmdline)
+	}
+	return []byte(out), nil
+}
+
+func TestImportedPoolsWith(t *testing.T) {
+	assert := require.New(t)
+
+	runner := fakeRunner{
+		"zpool get all": `NAME  PROPERTY               VALUE    SOURCE
+tank  ashift                 0        default
+tank  feature@async_destroy  enabled  local
+tank  feature@lz4_compress   active   local
+`,
+		"zfs get all": `NAME       PROPERTY     VALUE       SOURCE
+tank       type         filesystem  -
+tank       compression  lz4         local
+tank/home  type         filesystem  -
+tank/home  compression  lz4         inherited from tank
+tank/home  atime        off         local
+`,
+		"zpool status -P": `  pool: tank
+ state: ONLINE
+config:
+
+	NAME          STATE     READ WRITE CKSUM
+	tank          ONLINE       0     0     0
+	  mirror-0    ONLINE       0     0     0
+	    /dev/sda  ONLINE       0     0     0
+	    /dev/sdb  ONLINE       0     0     0
+
+errors: No known data errors
+`,
+		"zdb -C tank": `tank:
+    vdev_tree:
+        type: 'root'
+        children[0]:
+            type: 'mirror'
+            ashift: 12
+            is_log: 0
+`,
+	}
+
+	pools, err := ImportedPoolsWith(runner)
+	assert.NoError(err)
+	assert.Len(pools, 1)
+
+	pool := pools["tank"]
+	cmdline, err := pool.CreatePoolCommand(&FlagOptions{DisableAllFeatures: true, MinimalFeatures: true})
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o ashift=12 -o feature@lz4_compress=enabled -O compression=lz4 tank mirror /dev/sda /dev/sdb", strings.Join(cmdline, " "))
+
+	cmdline, err = pool.CreateDatasetCommand("tank/home", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o atime=off tank/home", strings.Join(cmdline, " "))
+
+	delete(runner, "zpool status -P")
+	_, err = ImportedPoolsWith(runner)
+	assert.EqualError(err, "unexpected command: zpool status -P")
+
+	delete(runner, "zfs get all")
+	_, err = ImportedPoolsWith(runner)
+	assert.EqualError(err, "zfs get all: unexpected command: zfs get all")
+}
+
+func TestImportedPoolsContext(t *testing.T) {
+	assert := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ImportedPoolsContext(ctx)
+	assert.ErrorIs(err, context.Canceled)
+}
+
+// A fakeRunner streaming its output, whose Close returns closeErr
+type fakeStreamRunner struct {
+	fakeRunner
+	streamed []string
+	closeErr error
+}
+
+func (f *fakeStreamRunner) Stream(name string, args ...string) (io.ReadCloser, error) {
+	b, err := f.Run(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	f.streamed = append(f.streamed, strings.Join(append([]string{name}, args...), " "))
+	return struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(b), closerFunc(func() error { return f.closeErr })}, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func TestStreamRunner(t *testing.T) {
+	assert := require.New(t)
+
+	runner := &fakeStreamRunner{fakeRunner: fakeRunner{
+		"zpool get all": `NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    0      default
+`,
+		"zfs get all": `NAME    PROPERTY  VALUE       SOURCE
+tank    type      filesystem  -
+tank/a  type      filesystem  -
+tank/a  atime     off         local
+`,
+	}}
+
+	in := RunnerInput(runner)
+	in.ZpoolStatus = nil
+	pools, err := ImportedPoolsFrom(in)
+	assert.NoError(err)
+	assert.Equal([]string{"zfs get all"}, runner.streamed)
+	assert.Len(pools["tank"].Datasets.Ordered, 2)
+
+	// zfs failing after its output parsed still fails
+	runner.closeErr = errors.New("exit status 1")
+	_, err = ImportedPoolsFrom(in)
+	assert.EqualError(err, "zfs get all: exit status 1")
+}
+
+func TestExecRunnerStream(t *testing.T) {
+	assert := require.New(t)
+
+	r, err := DefaultRunner.(StreamRunner).Stream("sh", "-c", "echo foo; exit 3")
+	assert.NoError(err)
+	b, err := io.ReadAll(r)
+	assert.NoError(err)
+	assert.Equal("foo\n", string(b))
+	var exitErr *exec.ExitError
+	assert.ErrorAs(r.Close(), &exitErr)
+	assert.Equal(3, exitErr.ExitCode())
+
+	// Closing before the output is read doesn't wait on a blocked writer
+	r, err = DefaultRunner.(StreamRunner).Stream("yes")
+	assert.NoError(err)
+	assert.Error(r.Close())
+}
+
+func TestParseableInput(t *testing.T) {
+	assert := require.New(t)
+
+	runner := fakeRunner{
+		"zpool get all": `NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    12     local
+`,
+		"zpool get -p all": `NAME  PROPERTY  VALUE  SOURCE
+tank  ashift    12     local
+`,
+		"zfs get all": `NAME      PROPERTY        VALUE       SOURCE
+tank      type            filesystem  -
+tank/a    type            filesystem  -
+tank/a    quota           10G         local
+tank/a    recordsize      1M          local
+tank/a    refquota        none        default
+tank/vol  type            volume      -
+tank/vol  volsize         1.50G       local
+tank/vol  volblocksize    16K         -
+tank/vol  refreservation  none        default
+`,
+		"zfs get -p all": `NAME      PROPERTY        VALUE       SOURCE
+tank      type            filesystem  -
+tank/a    type            filesystem  -
+tank/a    quota           10737418240 local
+tank/a    recordsize      1048576     local
+tank/a    refquota        0           default
+tank/vol  type            volume      -
+tank/vol  volsize         1610612736  local
+tank/vol  volblocksize    16384       -
+tank/vol  refreservation  0           default
+`,
+	}
+
+	formatted := RunnerInput(runner)
+	formatted.ZpoolStatus = nil
+	parseable := ParseableInput(runner)
+	parseable.ZpoolStatus = nil
+
+	expected := map[*Input]map[string]string{
+		formatted: {
+			"tank/a":   "zfs create -o quota=10G -o recordsize=1M tank/a",
+			"tank/vol": "zfs create -s -V 1.50G -b 16K tank/vol",
+		},
+		parseable: {
+			"tank/a":   "zfs create -o quota=10737418240 -o recordsize=1048576 tank/a",
+			"tank/vol": "zfs create -s -V 1610612736 -b 16384 tank/vol",
+		},
+	}
+
+	for in, commands := range expected {
+		pools, err := ImportedPoolsFrom(in)
+		assert.NoError(err)
+		for name, out := range commands {
+			cmdline, err := pools["tank"].CreateDatasetCommand(name, nil)
+			assert.NoError(err)
+			assert.Equal(out, strings.Join(cmdline, " "))
+		}
+	}
+
+	// Both forms describe the same sizes
+	for name := range expected[formatted] {
+		a := strings.Fields(expected[formatted][name])
+		b := strings.Fields(expected[parseable][name])
+		assert.Len(b, len(a))
+		for i := range a {
+			if a[i] == b[i] {
+				continue
+			}
+			x, ok := parseSize(a[i][strings.IndexByte(a[i], '=')+1:])
+			assert.True(ok, a[i])
+			y, ok := parseSize(b[i][strings.IndexByte(b[i], '=')+1:])
+			assert.True(ok, b[i])
+			assert.Equal(x, y, "%s != %s", a[i], b[i])
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package zfs
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Snapshot struct {
+	// Full name, e.g. tank/home@daily
+	Name       string
+	Properties map[string]*Property
+	// User hold tags, from zfs holds
+	Holds []string
+}
+
+// Returns the dataset portion of a snapshot or bookmark name
+func snapshotDataset(name string) string {
+	if i := strings.IndexAny(name, "@#"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// Returns the name of the pool containing a dataset, snapshot, or bookmark
+func datasetPool(name string) string {
+	return strings.SplitN(snapshotDataset(name), "/", 2)[0]
+}
+
+// zfs get prints creation as "%a %b %e %k:%M %Y", or as seconds with -p
+func parseCreation(value string) time.Time {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0)
+	}
+	t, _ := time.ParseInLocation("Mon Jan 2 15:04 2006", strings.Join(strings.Fields(value), " "), time.Local)
+	return t
+}
+
+func (s *Snapshot) creation() time.Time {
+	if prop, ok := s.Properties["creation"]; ok {
+		return parseCreation(prop.Value())
+	}
+	return time.Time{}
+}
+
+// Breaks ties between snapshots created within the same minute
+func (s *Snapshot) createtxg() uint64 {
+	if prop, ok := s.Properties["createtxg"]; ok {
+		txg, _ := strconv.ParseUint(prop.Value(), 10, 64)
+		return txg
+	}
+	return 0
+}
+
+func sortSnapshots(snapshots []*Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		ci, cj := snapshots[i].creation(), snapshots[j].creation()
+		if !ci.Equal(cj) {
+			return ci.Before(cj)
+		}
+		return snapshots[i].createtxg() < snapshots[j].createtxg()
+	})
+}
+
+// Only locally set properties, typically user properties, can be given to zfs snapshot
+func (s *Snapshot) flags() (flags []string) {
+	var sorted sortedProperties
+	for _, p := range s.Properties {
+		sorted = append(sorted, p)
+	}
+	sort.Sort(sorted)
+
+	for _, p := range sorted {
+		if p.Source.Location == PropertyLocal && !p.statusOnly() {
+			flags = append(flags, "-o", fmt.Sprintf("%s=%s", p.Name, p.localValue))
+		}
+	}
+	return flags
+}
+
+func (p *Pool) CreateSnapshotCommand(name string) (cmdline []string, err error) {
+	if s := findSnapshot(map[string]*Pool{p.Name: p}, name); s != nil {
+		cmdline = []string{"zfs", "snapshot"}
+		cmdline = append(cmdline, s.flags()...)
+		cmdline = append(cmdline, s.Name)
+		return cmdline, nil
+	}
+	return nil, fmt.Errorf("snapshot %s not found in pool %s", name, p.Name)
+}
+
+// Returns the property map of the snapshot or bookmark with the given name
+func (p *parser) childProperties(name string) map[string]*Property {
+	if strings.ContainsRune(name, '#') {
+		b, ok := p.bookmarkIndex[name]
+		if !ok {
+			b = &Bookmark{
+				Name:       name,
+				Properties: make(map[string]*Property),
+			}
+			p.bookmarks = append(p.bookmarks, b)
+			p.bookmarkIndex[name] = b
+		}
+		return b.Properties
+	}
+
+	snap, ok := p.snapshotIndex[name]
+	if !ok {
+		snap = &Snapshot{
+			Name:       name,
+			Properties: make(map[string]*Property),
+		}
+		p.snapshots = append(p.snapshots, snap)
+		p.snapshotIndex[name] = snap
+	}
+	return snap.Properties
+}
+
+// Parses a property row of a snapshot or bookmark
+func (p *parser) parseChildProperty(pool *Pool, set *Dataset, m [][]byte) error {
+	childName := string(m[1])
+	name := string(m[2])
+	value := string(m[3])
+	raw := sourceName(m[4])
+	parent := string(m[5])
+
+	// The dataset currently being parsed is not yet in the pool index
+	var src PropertySource
+	if prop, ok := set.Properties[name]; ok && raw == "inherited from " && parent == set.Name {
+		src = PropertySource{
+			Location:  PropertyInherited,
+			Parent:    set.Name,
+			Inherited: prop,
+		}
+	} else {
+		var err error
+		src, err = parseSource(name, value, raw, parent, pool)
+		if err != nil {
+			src, err = p.missingParent(childName, name, err)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %w", childName, err)
+		}
+	}
+
+	p.childProperties(childName)[name] = &Property{
+		Name:       name,
+		localValue: value,
+		Source:     src,
+	}
+	return nil
+}
+
+func findDataset(pools map[string]*Pool, name string) *Dataset {
+	if pool, ok := pools[datasetPool(name)]; ok {
+		return pool.Datasets.Index[snapshotDataset(name)]
+	}
+	return nil
+}
+
+func findSnapshot(pools map[string]*Pool, name string) *Snapshot {
+	if set := findDataset(pools, name); set != nil {
+		for _, s := range set.Snapshots {
+			if s.Name == name {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+func attachSnapshots(pools map[string]*Pool, snapshots []*Snapshot, bookmarks []*Bookmark) {
+	for _, s := range snapshots {
+		set := findDataset(pools, s.Name)
+		if set == nil {
+			Warnf("ignoring snapshot %s of unknown dataset", s.Name)
+			continue
+		}
+		set.Snapshots = append(set.Snapshots, s)
+	}
+
+	for _, pool := range pools {
+		for _, set := range pool.Datasets.Ordered {
+			sortSnapshots(set.Snapshots)
+		}
+	}
+
+	for _, b := range bookmarks {
+		set := findDataset(pools, b.Name)
+		if set == nil {
+			Warnf("ignoring bookmark %s of unknown dataset", b.Name)
+			continue
+		}
+		b.Source = b.findSource(set)
+		set.Bookmarks = append(set.Bookmarks, b)
+	}
+}
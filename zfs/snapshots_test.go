@@ -0,0 +1,62 @@
+package zfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSnapshots(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME              PROPERTY              VALUE                  SOURCE
+tank              type                  filesystem             -
+tank              compression           lz4                    local
+tank@weekly       type                  snapshot               -
+tank@weekly       creation              Sun Dec  4  9:15 2022  -
+tank/home         type                  filesystem             -
+tank/home         compression           lz4                    inherited from tank
+tank/home         atime                 off                    local
+tank/home@b       type                  snapshot               -
+tank/home@b       creation              Mon Dec  5 10:00 2022  -
+tank/home@b       createtxg             200                    -
+tank/home@b       compression           lz4                    inherited from tank
+tank/home@b       atime                 off                    inherited from tank/home
+tank/home@a       type                  snapshot               -
+tank/home@a       creation              Mon Dec  5 10:00 2022  -
+tank/home@a       createtxg             100                    -
+tank/home@a       com.example:note      keep me                local
+tank/home@first   type                  snapshot               -
+tank/home@first   creation              Sun Dec  4  0:24 2022  -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	pool := pools["tank"]
+	var names []string
+	for _, s := range pool.Datasets.Index["tank/home"].Snapshots {
+		names = append(names, s.Name)
+	}
+	assert.Equal([]string{"tank/home@first", "tank/home@a", "tank/home@b"}, names)
+	assert.Len(pool.Datasets.Index["tank"].Snapshots, 1)
+
+	b := pool.Datasets.Index["tank/home"].Snapshots[2]
+	assert.Equal(PropertyInherited, b.Properties["atime"].Source.Location)
+	assert.Equal("off", b.Properties["atime"].Value())
+
+	expected := map[string]string{
+		"tank@weekly":     "zfs snapshot tank@weekly",
+		"tank/home@a":     "zfs snapshot -o com.example:note=keep me tank/home@a",
+		"tank/home@b":     "zfs snapshot tank/home@b",
+		"tank/home@first": "zfs snapshot tank/home@first",
+	}
+	for name, cmd := range expected {
+		cmdline, err := pool.CreateSnapshotCommand(name)
+		assert.NoError(err)
+		assert.Equal(cmd, strings.Join(cmdline, " "))
+	}
+
+	_, err = pool.CreateSnapshotCommand("tank/home@missing")
+	assert.EqualError(err, "snapshot tank/home@missing not found in pool tank")
+}
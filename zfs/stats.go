@@ -0,0 +1,34 @@
+package zfs
+
+// Stats summarizes a pool
+type Stats struct {
+	Pool     string `json:"pool"`
+	Datasets int    `json:"datasets"`
+	// Dataset properties set locally or received, rather than inherited or
+	// left at their defaults
+	LocalProperties  int `json:"local_properties"`
+	EncryptionRoots  int `json:"encryption_roots"`
+	InactiveFeatures int `json:"inactive_features"`
+}
+
+// Stats counts the datasets of p, their explicitly set properties and
+// encryption roots, and the features of p that are enabled but not active
+func (p *Pool) Stats() Stats {
+	s := Stats{Pool: p.Name, Datasets: len(p.Datasets.Ordered)}
+	for _, d := range p.Datasets.Ordered {
+		if d.IsEncryptionRoot() {
+			s.EncryptionRoots++
+		}
+		for _, prop := range d.Properties {
+			if (prop.Source.Location == PropertyLocal || prop.Source.Location == PropertyReceived) && !prop.statusOnly() {
+				s.LocalProperties++
+			}
+		}
+	}
+	for _, prop := range p.Properties {
+		if prop.isFeature() && prop.localValue == FeatureEnabled {
+			s.InactiveFeatures++
+		}
+	}
+	return s
+}
@@ -0,0 +1,38 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME          PROPERTY        VALUE       SOURCE
+tank          type            filesystem  -
+tank          compression     lz4         local
+tank          atime           on          default
+tank/enc      type            filesystem  -
+tank/enc      compression     lz4         inherited from tank
+tank/enc      encryptionroot  tank/enc    -
+tank/enc      encryption      on          local
+tank/enc      keyformat       passphrase  -
+tank/enc      keylocation     prompt      local
+tank/enc      pbkdf2iters     350000      -
+tank/enc      keystatus       available   -
+tank/enc      atime           off         received`), []byte(`NAME  PROPERTY               VALUE     SOURCE
+tank  feature@async_destroy  enabled   local
+tank  feature@lz4_compress   active    local
+tank  feature@draid          disabled  local
+tank  feature@bookmarks      enabled   local`))
+	assert.NoError(err)
+
+	assert.Equal(Stats{
+		Pool:             "tank",
+		Datasets:         2,
+		LocalProperties:  4,
+		EncryptionRoots:  1,
+		InactiveFeatures: 2,
+	}, pools["tank"].Stats())
+}
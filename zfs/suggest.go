@@ -0,0 +1,76 @@
+package zfs
+
+import (
+	"fmt"
+	"path"
+	"sort"
+)
+
+// Suggestion is a set of properties that sibling datasets all set locally to
+// the same values, which could instead be set once on their parent and
+// inherited
+type Suggestion struct {
+	Parent   string
+	Children []string
+	// name=value, sorted by name
+	Settings []string
+}
+
+// SuggestInheritance returns a Suggestion for each dataset with at least
+// minChildren children that share locally set, inheritable properties, in
+// dataset order. It is advisory, the commands recreating p are unaffected.
+func (p *Pool) SuggestInheritance(minChildren int) (suggestions []Suggestion) {
+	children := map[string][]*Dataset{}
+	for _, d := range p.Datasets.Ordered {
+		if !isRootDataset(d.Name) {
+			parent := path.Dir(d.Name)
+			children[parent] = append(children[parent], d)
+		}
+	}
+
+	for _, parent := range p.Datasets.Ordered {
+		sets := children[parent.Name]
+		if len(sets) < minChildren || len(sets) < 2 {
+			continue
+		}
+
+		shared := sharedSettings(sets[0])
+		for _, set := range sets[1:] {
+			settings := sharedSettings(set)
+			for name, value := range shared {
+				if s, ok := settings[name]; !ok || s != value {
+					delete(shared, name)
+				}
+			}
+		}
+		if len(shared) == 0 {
+			continue
+		}
+
+		s := Suggestion{Parent: parent.Name}
+		for _, set := range sets {
+			s.Children = append(s.Children, set.Name)
+		}
+		for name, value := range shared {
+			s.Settings = append(s.Settings, fmt.Sprintf("%s=%s", name, value))
+		}
+		sort.Strings(s.Settings)
+		suggestions = append(suggestions, s)
+	}
+	return suggestions
+}
+
+// Returns the locally set properties of d that its children could inherit
+func sharedSettings(d *Dataset) map[string]string {
+	settings := map[string]string{}
+	for _, prop := range d.Properties {
+		if prop.Source.Location != PropertyLocal || prop.statusOnly() || prop.isEncryption() {
+			continue
+		}
+		if _, ok := uninheritableProperties[prop.Name]; ok {
+			continue
+		}
+		settings[prop.Name] = prop.Value()
+	}
+	return settings
+}
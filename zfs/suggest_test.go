@@ -0,0 +1,44 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestInheritance(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME         PROPERTY     VALUE       SOURCE
+tank         type         filesystem  -
+tank/home    type         filesystem  -
+tank/home/a  type         filesystem  -
+tank/home/a  atime        off         local
+tank/home/a  compression  zstd        local
+tank/home/a  quota        10G         local
+tank/home/b  type         filesystem  -
+tank/home/b  atime        off         local
+tank/home/b  compression  zstd        local
+tank/home/b  quota        10G         local
+tank/home/c  type         filesystem  -
+tank/home/c  atime        off         local
+tank/home/c  compression  zstd        local
+tank/home/c  recordsize   1M          local
+tank/vm      type         filesystem  -
+tank/vm/x    type         filesystem  -
+tank/vm/x    atime        off         local
+tank/vm/y    type         filesystem  -
+tank/vm/y    atime        on          local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	expected := []Suggestion{{
+		Parent:   "tank/home",
+		Children: []string{"tank/home/a", "tank/home/b", "tank/home/c"},
+		Settings: []string{"atime=off", "compression=zstd"},
+	}}
+	assert.Equal(expected, pools["tank"].SuggestInheritance(2))
+	assert.Equal(expected, pools["tank"].SuggestInheritance(3))
+	assert.Empty(pools["tank"].SuggestInheritance(4))
+}
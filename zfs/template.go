@@ -0,0 +1,31 @@
+package zfs
+
+import (
+	"strings"
+	"text/template"
+
+	"gopkg.in/alessio/shellescape.v1"
+)
+
+// TemplateData is the data given to a template parsed by ParseTemplate
+type TemplateData struct {
+	// Commands in the order they would be printed, as with --json
+	Commands []Command
+	// Every pool in the input, including those that no command recreates
+	Pools map[string]*Pool
+}
+
+// TemplateFuncs are the functions templates have besides the text/template
+// builtins: shellescape quotes an argument for sh, and join joins its last
+// argument with the first as a separator, as in {{.Argv | join " "}}
+var TemplateFuncs = template.FuncMap{
+	"shellescape": shellescape.Quote,
+	"join": func(sep string, elems []string) string {
+		return strings.Join(elems, sep)
+	},
+}
+
+// ParseTemplate parses text as a text/template with TemplateFuncs
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(TemplateFuncs).Option("missingkey=error").Parse(text)
+}
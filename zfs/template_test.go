@@ -0,0 +1,46 @@
+package zfs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME       PROPERTY     VALUE         SOURCE
+tank       type         filesystem    -
+tank       compression  lz4           local
+tank/home  type         filesystem    -
+tank/home  org:note     it's mine     local`), []byte(`NAME  PROPERTY               VALUE    SOURCE
+tank  feature@async_destroy  enabled  local`))
+	assert.NoError(err)
+
+	commands, err := pools["tank"].AllCommands(nil)
+	assert.NoError(err)
+
+	tmpl, err := ParseTemplate("csv", `kind,name,command
+{{range .Commands}}{{.Kind}},{{.Target}},{{range $i, $arg := .Argv}}{{if $i}} {{end}}{{shellescape $arg}}{{end}}
+{{end}}{{range $name, $pool := .Pools}}# {{$name}}: {{len $pool.Datasets.Ordered}} datasets
+{{end}}{{(index .Commands 0).Argv | join "|"}}
+`)
+	assert.NoError(err)
+
+	var out bytes.Buffer
+	assert.NoError(tmpl.Execute(&out, TemplateData{Commands: commands, Pools: pools}))
+	assert.Equal(`kind,name,command
+pool,tank,zpool create -d -o feature@async_destroy=enabled -O compression=lz4 tank
+dataset,tank/home,zfs create -o 'org:note=it'"'"'s mine' tank/home
+# tank: 2 datasets
+zpool|create|-d|-o|feature@async_destroy=enabled|-O|compression=lz4|tank
+`, out.String())
+
+	_, err = ParseTemplate("bad", "{{.Commands")
+	assert.Error(err)
+
+	tmpl, err = ParseTemplate("missing", "{{.Pools.bogus.Name}}")
+	assert.NoError(err)
+	assert.Error(tmpl.Execute(&out, TemplateData{Commands: commands, Pools: pools}))
+}
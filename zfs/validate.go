@@ -0,0 +1,44 @@
+package zfs
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Validate reports configuration the generated commands can't faithfully
+// reproduce: clones whose origin is missing, encryption roots that are not an
+// ancestor, which only happens via cloning, and properties settable only at
+// creation that zfs clone can't set. Concerns are sorted.
+func Validate(pools map[string]*Pool) (concerns []string) {
+	for _, pool := range pools {
+		for _, set := range pool.Datasets.Ordered {
+			rootSet, err := pool.encryptionRootOf(set)
+			if err != nil {
+				concerns = append(concerns, err.Error())
+			} else if rootSet != nil && !isParent(set.Name, rootSet.Name) {
+				concerns = append(concerns, fmt.Sprintf("%s: encryptionroot %s is not an ancestor, its encryption can't be inherited", set.Name, rootSet.Name))
+			}
+
+			origin := set.origin()
+			if origin == "" {
+				continue
+			}
+			if findSnapshot(pools, origin) == nil {
+				concerns = append(concerns, fmt.Sprintf("%s: origin %s not found, it would be created as a new dataset", set.Name, origin))
+				continue
+			}
+			for _, prop := range set.Properties {
+				if prop.Source.Location != PropertyReadonly || !prop.nonEncryptionInherit() {
+					continue
+				}
+				if _, ok := volumeProperties[prop.Name]; ok {
+					continue
+				}
+				concerns = append(concerns, fmt.Sprintf("%s: %s=%s can only be set at creation, which zfs clone does not allow", set.Name, prop.Name, prop.Value()))
+			}
+		}
+	}
+
+	sort.Strings(concerns)
+	return concerns
+}
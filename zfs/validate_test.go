@@ -0,0 +1,44 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME          PROPERTY        VALUE        SOURCE
+tank          type            filesystem   -
+tank          utf8only        off          -
+tank/enc      type            filesystem   -
+tank/enc      encryptionroot  tank/enc     -
+tank/enc@s    type            snapshot     -
+tank/base     type            filesystem   -
+tank/base     utf8only        off          -
+tank/base@s   type            snapshot     -
+tank/clone    type            filesystem   -
+tank/clone    origin          tank/base@s  -
+tank/clone    utf8only        on           -
+tank/same     type            filesystem   -
+tank/same     origin          tank/base@s  -
+tank/same     utf8only        off          -
+tank/copy     type            filesystem   -
+tank/copy     origin          tank/enc@s   -
+tank/copy     encryptionroot  tank/enc     -
+tank/orphan   type            filesystem   -
+tank/orphan   origin          tank/gone@s  -`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	assert.Equal([]string{
+		"tank/clone: utf8only=on can only be set at creation, which zfs clone does not allow",
+		"tank/copy: encryptionroot tank/enc is not an ancestor, its encryption can't be inherited",
+		"tank/orphan: origin tank/gone@s not found, it would be created as a new dataset",
+	}, Validate(pools))
+
+	delete(pools["tank"].Datasets.Index, "tank/enc")
+	assert.Contains(Validate(pools), "tank/copy encryptionroot tank/enc not found")
+}
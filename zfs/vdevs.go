@@ -0,0 +1,421 @@
+package zfs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VdevGroup is a top-level vdev. Kind is empty for a bare leaf device.
+type VdevGroup struct {
+	Kind     string
+	Children []string
+}
+
+func (g *VdevGroup) args(r *deviceResolver) (args []string) {
+	if g.Kind != "" {
+		args = append(args, g.Kind)
+	}
+	for _, dev := range g.Children {
+		args = append(args, r.resolve(dev))
+	}
+	return args
+}
+
+// Vdevs is the device topology of a pool, as reported by zpool status -P
+type Vdevs struct {
+	// Top-level data vdevs, in zpool status order
+	Data []*VdevGroup
+
+	// Allocation class vdevs, from the special and dedup sections
+	Special []*VdevGroup
+	Dedup   []*VdevGroup
+
+	// Auxiliary vdevs, from the logs, cache, and spares sections
+	Log   []*VdevGroup
+	Cache []*VdevGroup
+	Spare []*VdevGroup
+
+	// ashift of each top-level data vdev, from zdb -C
+	Ashift []int
+}
+
+// Returns the ashift to request at creation, or 0 if zdb supplied none and it
+// should be autodetected. Any captured value is returned, even 9: zpool create
+// picks the ashift from the sectors the target devices report, so a pool of
+// 512-byte alignment recreated on 4K devices would otherwise change.
+func (v *Vdevs) ashift(pool string) int {
+	if v == nil || len(v.Ashift) == 0 {
+		return 0
+	}
+
+	ashift := v.Ashift[0]
+	for _, a := range v.Ashift[1:] {
+		if a != ashift {
+			Warnf("%s has top-level vdevs with differing ashift values, using %d", pool, ashift)
+			break
+		}
+	}
+	return ashift
+}
+
+func appendVdevClass(args []string, r *deviceResolver, keyword string, groups []*VdevGroup) []string {
+	if len(groups) == 0 {
+		return args
+	}
+	if keyword != "" {
+		args = append(args, keyword)
+	}
+	for _, g := range groups {
+		args = append(args, g.args(r)...)
+	}
+	return args
+}
+
+func (v *Vdevs) args(opts *FlagOptions) (args []string) {
+	if v == nil {
+		return nil
+	}
+	r := newDeviceResolver(opts.DeviceNaming)
+	args = appendVdevClass(args, r, "", v.Data)
+	args = appendVdevClass(args, r, "special", v.Special)
+	args = appendVdevClass(args, r, "dedup", v.Dedup)
+	args = appendVdevClass(args, r, "log", v.Log)
+	args = appendVdevClass(args, r, "cache", v.Cache)
+	args = appendVdevClass(args, r, "spare", v.Spare)
+	return args
+}
+
+// Warns if set is given special_small_blocks on a pool that will have no
+// special vdev, where it has no effect. Without a topology there is nothing to
+// check against.
+func (p *Pool) checkSpecialSmallBlocks(set *Dataset, opts *FlagOptions) {
+	if p.Vdevs == nil || len(p.Vdevs.Special) != 0 {
+		return
+	}
+	prop, ok := set.Properties["special_small_blocks"]
+	if !ok || prop.localValue == "0" || prop.omitReason(opts) != "" {
+		return
+	}
+	Warnf("%s sets special_small_blocks=%s, but pool %s has no special vdev", set.Name, prop.localValue, p.Name)
+}
+
+// Advises on logbias and sync settings of set that assume a log vdev, if the
+// topology shows the pool has none
+func (p *Pool) checkLogDevice(set *Dataset, opts *FlagOptions) {
+	if p.Vdevs == nil || len(p.Vdevs.Log) != 0 {
+		return
+	}
+	if prop, ok := set.Properties["logbias"]; ok && prop.localValue == "throughput" && prop.omitReason(opts) == "" {
+		Advisef("%s sets logbias=throughput, but pool %s has no log vdev", set.Name, p.Name)
+	}
+	if prop, ok := set.Properties["sync"]; ok && prop.localValue == "always" && prop.omitReason(opts) == "" {
+		Advisef("%s sets sync=always, but pool %s has no log vdev to absorb its synchronous writes", set.Name, p.Name)
+	}
+}
+
+// Maps a zpool status section heading to its vdev class, or nil if unknown
+func (v *Vdevs) section(heading string) *[]*VdevGroup {
+	switch heading {
+	case "special":
+		return &v.Special
+	case "dedup":
+		return &v.Dedup
+	case "logs":
+		return &v.Log
+	case "cache":
+		return &v.Cache
+	case "spares":
+		return &v.Spare
+	}
+	return nil
+}
+
+var (
+	statusPool   = regexp.MustCompile(`^\s*pool: (\S+)$`)
+	statusHeader = regexp.MustCompile(`^\s*NAME\s+STATE\s+READ\s+WRITE\s+CKSUM$`)
+	statusGroup  = regexp.MustCompile(`^(mirror|raidz[123]?|draid[0-9:a-z]*|replacing|spare)-[0-9]+$`)
+	// Distributed spare of a dRAID vdev, as draid<parity>-<vdev>-<spare>
+	statusDraidSpare = regexp.MustCompile(`^draid[0-9]+-([0-9]+)-[0-9]+$`)
+)
+
+// dRAID layout of a vdev, as in draid2:4d:11c:1s, with 0 for counts that
+// are not given
+type draidLayout struct {
+	parity, data, children, spares int
+}
+
+// Parses the layout of a draid group kind, whose counts may come in any order
+func parseDraid(kind string) (l draidLayout, err error) {
+	fields := strings.Split(kind, ":")
+	l.parity = 1
+	if p := strings.TrimPrefix(fields[0], "draid"); p != "" {
+		if l.parity, err = strconv.Atoi(p); err != nil {
+			return l, fmt.Errorf("unsupported vdev: %s", kind)
+		}
+	}
+	for _, f := range fields[1:] {
+		if f == "" {
+			return l, fmt.Errorf("unsupported vdev: %s", kind)
+		}
+		n, err := strconv.Atoi(f[:len(f)-1])
+		if err != nil {
+			return l, fmt.Errorf("unsupported vdev: %s", kind)
+		}
+		switch f[len(f)-1] {
+		case 'd':
+			l.data = n
+		case 'c':
+			l.children = n
+		case 's':
+			l.spares = n
+		default:
+			return l, fmt.Errorf("unsupported vdev: %s", kind)
+		}
+	}
+	return l, nil
+}
+
+// Returns the layout as zpool create takes it, leaving out unknown counts
+func (l draidLayout) String() string {
+	s := fmt.Sprintf("draid%d", l.parity)
+	if l.data != 0 {
+		s += fmt.Sprintf(":%dd", l.data)
+	}
+	if l.children != 0 {
+		s += fmt.Sprintf(":%dc", l.children)
+	}
+	if l.spares != 0 {
+		s += fmt.Sprintf(":%ds", l.spares)
+	}
+	return s
+}
+
+// Completes the kind of each draid group in v from its children and the
+// distributed spares counted per vdev id, warning if its layout can't be
+// fully reconstructed
+func (v *Vdevs) reconstructDraid(pool string, ids map[*VdevGroup]string, spares map[string]int) error {
+	for _, g := range v.Data {
+		if !strings.HasPrefix(g.Kind, "draid") {
+			continue
+		}
+		l, err := parseDraid(g.Kind)
+		if err != nil {
+			return fmt.Errorf("%s %w", pool, err)
+		}
+		if l.children == 0 {
+			l.children = len(g.Children)
+		} else if l.children != len(g.Children) {
+			Warnf("%s vdev %s lists %d children, the recreated vdev may differ", pool, g.Kind, len(g.Children))
+		}
+		if n := spares[ids[g]]; l.spares == 0 {
+			l.spares = n
+		} else if n != 0 && n != l.spares {
+			Warnf("%s vdev %s lists %d distributed spares, the recreated vdev may differ", pool, g.Kind, n)
+		}
+		if l.data == 0 {
+			Warnf("%s vdev %s does not give its data disks per redundancy group, zpool create will choose them", pool, g.Kind)
+		}
+		g.Kind = l.String()
+	}
+	return nil
+}
+
+// Returns the zpool create keyword for a group row, or "" for a leaf device
+func groupKind(name string) (string, error) {
+	m := statusGroup.FindStringSubmatch(name)
+	if m == nil {
+		return "", nil
+	}
+	switch kind := m[1]; kind {
+	case "replacing", "spare":
+		return "", fmt.Errorf("unsupported vdev: %s", name)
+	case "raidz":
+		return "raidz1", nil
+	default:
+		return kind, nil
+	}
+}
+
+func zpoolStatusRaw(r CommandRunner) ([]byte, error) {
+	return r.Run(`zpool`, `status`, `-P`)
+}
+
+func zdbConfigRaw(r CommandRunner, pool string) ([]byte, error) {
+	return r.Run(`zdb`, `-C`, pool)
+}
+
+var (
+	zdbChild = regexp.MustCompile(`^children\[[0-9]+\]:$`)
+	zdbValue = regexp.MustCompile(`^([a-z_]+): (.*)$`)
+)
+
+func zdbIndent(l string) int {
+	return len(l) - len(strings.TrimLeft(l, " "))
+}
+
+// Returns the ashift of each top-level data vdev in zdb -C output
+func zdbAshiftParse(b []byte) ([]int, error) {
+	var ashifts []int
+
+	treeIndent := -1
+	var ashift, isLog, bias string
+	flush := func() error {
+		if ashift == "" {
+			return nil
+		}
+		if isLog != "1" && bias == "" {
+			a, err := strconv.Atoi(ashift)
+			if err != nil {
+				return fmt.Errorf("invalid ashift: %s", ashift)
+			}
+			ashifts = append(ashifts, a)
+		}
+		ashift, isLog, bias = "", "", ""
+		return nil
+	}
+
+	for _, l := range strings.Split(string(b), "\n") {
+		indent := zdbIndent(l)
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		if treeIndent < 0 {
+			if l == "vdev_tree:" {
+				treeIndent = indent
+			}
+			continue
+		}
+
+		switch {
+		case indent <= treeIndent:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			return ashifts, nil
+		case indent == treeIndent+4 && zdbChild.MatchString(l):
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case indent == treeIndent+8:
+			if m := zdbValue.FindStringSubmatch(l); m != nil {
+				switch m[1] {
+				case "ashift":
+					ashift = m[2]
+				case "is_log":
+					isLog = m[2]
+				case "alloc_bias":
+					bias = m[2]
+				}
+			}
+		}
+	}
+
+	if treeIndent < 0 {
+		return nil, fmt.Errorf("missing vdev_tree")
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return ashifts, nil
+}
+
+// Returns the nesting depth of a config row, where 0 is the pool itself
+func statusDepth(row string) int {
+	row = strings.TrimLeft(row, "\t")
+	return (len(row) - len(strings.TrimLeft(row, " "))) / 2
+}
+
+func zpoolStatusParse(b []byte) (map[string]*Vdevs, error) {
+	pools := make(map[string]*Vdevs)
+
+	var poolName string
+	var vdevs *Vdevs
+	var section *[]*VdevGroup
+	var group *VdevGroup
+	// Top-level vdev id of each draid group, and per pool the distributed
+	// spares of each id
+	draidIds := make(map[*VdevGroup]string)
+	draidSpares := make(map[string]map[string]int)
+	inConfig := false
+	for _, l := range strings.Split(string(b), "\n") {
+		if inConfig {
+			if strings.TrimSpace(l) == "" {
+				inConfig = false
+				continue
+			}
+
+			name := strings.Fields(l)[0]
+			kind, err := groupKind(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s %w", poolName, err)
+			}
+
+			switch depth := statusDepth(l); {
+			case depth == 0:
+				group = nil
+				if name == poolName {
+					section = &vdevs.Data
+				} else if section = vdevs.section(name); section == nil {
+					return nil, fmt.Errorf("%s unsupported vdev section: %s", poolName, name)
+				}
+			case section == nil:
+				return nil, fmt.Errorf("%s unsupported vdev: %s", poolName, name)
+			case depth == 1 && kind != "":
+				group = &VdevGroup{Kind: kind}
+				*section = append(*section, group)
+				if strings.HasPrefix(kind, "draid") {
+					draidIds[group] = name[strings.LastIndexByte(name, '-')+1:]
+				}
+			case depth == 1 && section == &vdevs.Spare && statusDraidSpare.MatchString(name):
+				// Created with the dRAID vdev, as counted in its kind
+				group = nil
+				draidSpares[poolName][statusDraidSpare.FindStringSubmatch(name)[1]]++
+			case depth == 1:
+				group = nil
+				*section = append(*section, &VdevGroup{Children: []string{name}})
+			case depth == 2 && kind == "" && group != nil:
+				group.Children = append(group.Children, name)
+			default:
+				return nil, fmt.Errorf("%s unsupported vdev: %s", poolName, name)
+			}
+			continue
+		}
+
+		if m := statusPool.FindStringSubmatch(l); m != nil {
+			poolName = m[1]
+			if _, ok := pools[poolName]; ok {
+				return nil, &DuplicatePoolError{Name: poolName}
+			}
+			vdevs = &Vdevs{}
+			section = nil
+			group = nil
+			pools[poolName] = vdevs
+			draidSpares[poolName] = make(map[string]int)
+			continue
+		}
+
+		if statusHeader.MatchString(l) {
+			if vdevs == nil {
+				return nil, fmt.Errorf("unexpected config: %s", strings.TrimSpace(l))
+			}
+			inConfig = true
+		}
+	}
+
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := pools[name].reconstructDraid(name, draidIds, draidSpares[name]); err != nil {
+			return nil, err
+		}
+	}
+	return pools, nil
+}
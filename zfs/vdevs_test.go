@@ -0,0 +1,483 @@
+package zfs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZpoolStatusParse(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`  pool: foo
+ state: ONLINE
+  scan: scrub repaired 0B in 00:00:01 with 0 errors on Sun Dec  4 00:24:01 2022
+config:
+
+	NAME                      STATE     READ WRITE CKSUM
+	foo                       ONLINE       0     0     0
+	  /dev/sda1               ONLINE       0     0     0
+	  /dev/sdb1               ONLINE       0     0     0
+
+errors: No known data errors
+
+  pool: bar
+ state: ONLINE
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	bar         ONLINE       0     0     0
+	  /tmp/bar  ONLINE       0     0     0
+
+errors: No known data errors
+`)
+
+	vdevs, err := zpoolStatusParse(input)
+	assert.NoError(err)
+	assert.Equal(map[string]*Vdevs{
+		"foo": {Data: []*VdevGroup{
+			{Children: []string{"/dev/sda1"}},
+			{Children: []string{"/dev/sdb1"}},
+		}},
+		"bar": {Data: []*VdevGroup{
+			{Children: []string{"/tmp/bar"}},
+		}},
+	}, vdevs)
+
+	pool, err := newPool("foo")
+	assert.NoError(err)
+	assert.NoError(pool.addDataset(&Dataset{Name: "foo"}))
+	pool.Vdevs = vdevs["foo"]
+
+	cmdline, err := pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal([]string{"zpool", "create", "-d", "foo", "/dev/sda1", "/dev/sdb1"}, cmdline)
+}
+
+func TestZpoolStatusParseGroups(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`  pool: tank
+ state: ONLINE
+config:
+
+	NAME          STATE     READ WRITE CKSUM
+	tank          ONLINE       0     0     0
+	  mirror-0    ONLINE       0     0     0
+	    /dev/sda  ONLINE       0     0     0
+	    /dev/sdb  ONLINE       0     0     0
+	  mirror-1    ONLINE       0     0     0
+	    /dev/sdc  ONLINE       0     0     0
+	    /dev/sdd  ONLINE       0     0     0
+
+errors: No known data errors
+
+  pool: vault
+ state: ONLINE
+config:
+
+	NAME          STATE     READ WRITE CKSUM
+	vault         ONLINE       0     0     0
+	  raidz2-0    ONLINE       0     0     0
+	    /dev/sde  ONLINE       0     0     0
+	    /dev/sdf  ONLINE       0     0     0
+	    /dev/sdg  ONLINE       0     0     0
+	    /dev/sdh  ONLINE       0     0     0
+
+errors: No known data errors
+`)
+
+	vdevs, err := zpoolStatusParse(input)
+	assert.NoError(err)
+
+	expected := map[string][]string{
+		"tank":  {"mirror", "/dev/sda", "/dev/sdb", "mirror", "/dev/sdc", "/dev/sdd"},
+		"vault": {"raidz2", "/dev/sde", "/dev/sdf", "/dev/sdg", "/dev/sdh"},
+	}
+	assert.Len(vdevs, len(expected))
+	for name, args := range expected {
+		assert.Equal(args, vdevs[name].args(defaultFlagOpts), name)
+	}
+}
+
+func TestZpoolStatusParseDraid(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	input := []byte(`  pool: tank
+ state: ONLINE
+config:
+
+	NAME                  STATE     READ WRITE CKSUM
+	tank                  ONLINE       0     0     0
+	  draid2:4d:7c:1s-0   ONLINE       0     0     0
+	    /dev/sda          ONLINE       0     0     0
+	    /dev/sdb          ONLINE       0     0     0
+	    /dev/sdc          ONLINE       0     0     0
+	    /dev/sdd          ONLINE       0     0     0
+	    /dev/sde          ONLINE       0     0     0
+	    /dev/sdf          ONLINE       0     0     0
+	    /dev/sdg          ONLINE       0     0     0
+	spares
+	  draid2-0-0          AVAIL
+	  /dev/sdz            AVAIL
+
+errors: No known data errors
+
+  pool: vault
+ state: ONLINE
+config:
+
+	NAME          STATE     READ WRITE CKSUM
+	vault         ONLINE       0     0     0
+	  draid-0     ONLINE       0     0     0
+	    /dev/sdh  ONLINE       0     0     0
+	    /dev/sdi  ONLINE       0     0     0
+	    /dev/sdj  ONLINE       0     0     0
+	    /dev/sdk  ONLINE       0     0     0
+	spares
+	  draid1-0-0  AVAIL
+	  draid1-0-1  AVAIL
+
+errors: No known data errors
+`)
+
+	vdevs, err := zpoolStatusParse(input)
+	assert.NoError(err)
+
+	expected := map[string][]string{
+		"tank":  {"draid2:4d:7c:1s", "/dev/sda", "/dev/sdb", "/dev/sdc", "/dev/sdd", "/dev/sde", "/dev/sdf", "/dev/sdg", "spare", "/dev/sdz"},
+		"vault": {"draid1:4c:2s", "/dev/sdh", "/dev/sdi", "/dev/sdj", "/dev/sdk"},
+	}
+	assert.Len(vdevs, len(expected))
+	for name, args := range expected {
+		assert.Equal(args, vdevs[name].args(defaultFlagOpts), name)
+	}
+	assert.Equal([]string{"vault vdev draid does not give its data disks per redundancy group, zpool create will choose them"}, warnings)
+
+	warnings = nil
+	_, err = zpoolStatusParse([]byte(`  pool: tank
+ state: ONLINE
+config:
+
+	NAME                  STATE     READ WRITE CKSUM
+	tank                  ONLINE       0     0     0
+	  draid1:2d:4c:0s-0   ONLINE       0     0     0
+	    /dev/sda          ONLINE       0     0     0
+	    /dev/sdb          ONLINE       0     0     0
+	    /dev/sdc          ONLINE       0     0     0
+
+errors: No known data errors
+`))
+	assert.NoError(err)
+	assert.Equal([]string{"tank vdev draid1:2d:4c:0s lists 3 children, the recreated vdev may differ"}, warnings)
+
+	_, err = zpoolStatusParse([]byte(`  pool: tank
+ state: ONLINE
+config:
+
+	NAME                  STATE     READ WRITE CKSUM
+	tank                  ONLINE       0     0     0
+	  draid1:2x-0         ONLINE       0     0     0
+	    /dev/sda          ONLINE       0     0     0
+
+errors: No known data errors
+`))
+	assert.EqualError(err, "tank unsupported vdev: draid1:2x")
+}
+
+func TestZpoolStatusParseAuxiliary(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`  pool: tank
+ state: ONLINE
+config:
+
+	NAME          STATE     READ WRITE CKSUM
+	tank          ONLINE       0     0     0
+	  raidz1-0    ONLINE       0     0     0
+	    /dev/sda  ONLINE       0     0     0
+	    /dev/sdb  ONLINE       0     0     0
+	    /dev/sdc  ONLINE       0     0     0
+	logs
+	  mirror-1    ONLINE       0     0     0
+	    /dev/sdd  ONLINE       0     0     0
+	    /dev/sde  ONLINE       0     0     0
+	cache
+	  /dev/sdf    ONLINE       0     0     0
+	  /dev/sdg    ONLINE       0     0     0
+	spares
+	  /dev/sdh    AVAIL
+
+errors: No known data errors
+`)
+
+	vdevs, err := zpoolStatusParse(input)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"raidz1", "/dev/sda", "/dev/sdb", "/dev/sdc",
+		"log", "mirror", "/dev/sdd", "/dev/sde",
+		"cache", "/dev/sdf", "/dev/sdg",
+		"spare", "/dev/sdh",
+	}, vdevs["tank"].args(defaultFlagOpts))
+}
+
+func TestZpoolStatusParseAllocationClasses(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`  pool: tank
+ state: ONLINE
+config:
+
+	NAME          STATE     READ WRITE CKSUM
+	tank          ONLINE       0     0     0
+	  mirror-0    ONLINE       0     0     0
+	    /dev/sda  ONLINE       0     0     0
+	    /dev/sdb  ONLINE       0     0     0
+	dedup
+	  /dev/sde    ONLINE       0     0     0
+	special
+	  mirror-1    ONLINE       0     0     0
+	    /dev/sdc  ONLINE       0     0     0
+	    /dev/sdd  ONLINE       0     0     0
+	logs
+	  /dev/sdf    ONLINE       0     0     0
+
+errors: No known data errors
+`)
+
+	vdevs, err := zpoolStatusParse(input)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"mirror", "/dev/sda", "/dev/sdb",
+		"special", "mirror", "/dev/sdc", "/dev/sdd",
+		"dedup", "/dev/sde",
+		"log", "/dev/sdf",
+	}, vdevs["tank"].args(defaultFlagOpts))
+}
+
+func TestZdbAshiftParse(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`tank:
+    version: 5000
+    name: 'tank'
+    vdev_children: 3
+    vdev_tree:
+        type: 'root'
+        id: 0
+        children[0]:
+            type: 'mirror'
+            id: 0
+            ashift: 12
+            is_log: 0
+            children[0]:
+                type: 'disk'
+                ashift: 9
+                path: '/dev/sda'
+        children[1]:
+            type: 'disk'
+            id: 1
+            ashift: 9
+            is_log: 1
+        children[2]:
+            type: 'disk'
+            id: 2
+            ashift: 13
+            is_log: 0
+        children[3]:
+            type: 'disk'
+            id: 3
+            ashift: 9
+            is_log: 0
+            alloc_bias: 'special'
+    features_for_read:
+        com.delphix:hole_birth
+`)
+
+	ashifts, err := zdbAshiftParse(input)
+	assert.NoError(err)
+	assert.Equal([]int{12, 13}, ashifts)
+
+	_, err = zdbAshiftParse([]byte("tank:\n    version: 5000\n"))
+	assert.EqualError(err, "missing vdev_tree")
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	pool, err := newPool("tank")
+	assert.NoError(err)
+	assert.NoError(pool.addDataset(&Dataset{Name: "tank"}))
+	pool.Vdevs = &Vdevs{
+		Data:   []*VdevGroup{{Children: []string{"/dev/sda"}}, {Children: []string{"/dev/sdb"}}},
+		Ashift: ashifts,
+	}
+
+	cmdline, err := pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o ashift=12 tank /dev/sda /dev/sdb", strings.Join(cmdline, " "))
+	assert.Equal([]string{"tank has top-level vdevs with differing ashift values, using 12"}, warnings)
+
+	// 512-byte alignment is kept even where zpool create would pick 4K
+	pool.Vdevs.Ashift = []int{9}
+	cmdline, err = pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o ashift=9 tank /dev/sda /dev/sdb", strings.Join(cmdline, " "))
+
+	pool.Vdevs.Ashift = nil
+	cmdline, err = pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d tank /dev/sda /dev/sdb", strings.Join(cmdline, " "))
+	pool.Vdevs.Ashift = []int{9}
+
+	pool.Properties = map[string]*Property{
+		"ashift": {Name: "ashift", localValue: "13", Source: PropertySource{Location: PropertyLocal}},
+	}
+	cmdline, err = pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -o ashift=13 tank /dev/sda /dev/sdb", strings.Join(cmdline, " "))
+}
+
+func TestSpecialSmallBlocks(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	input := []byte(`NAME        PROPERTY              VALUE       SOURCE
+tank        type                  filesystem  -
+tank        special_small_blocks  0           default
+tank/small  type                  filesystem  -
+tank/small  special_small_blocks  32K         local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+
+	// Without a topology there is nothing to check
+	cmdline, err := pool.CreateDatasetCommand("tank/small", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o special_small_blocks=32K tank/small", strings.Join(cmdline, " "))
+	assert.Empty(warnings)
+
+	pool.Vdevs = &Vdevs{
+		Data:    []*VdevGroup{{Children: []string{"/dev/sda"}}},
+		Special: []*VdevGroup{{Kind: "mirror", Children: []string{"/dev/nvme0n1", "/dev/nvme1n1"}}},
+	}
+	cmdline, err = pool.CreateDatasetCommand("tank/small", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o special_small_blocks=32K tank/small", strings.Join(cmdline, " "))
+	assert.Empty(warnings)
+
+	pool.Vdevs.Special = nil
+	cmdline, err = pool.CreateDatasetCommand("tank/small", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o special_small_blocks=32K tank/small", strings.Join(cmdline, " "))
+	assert.Equal([]string{"tank/small sets special_small_blocks=32K, but pool tank has no special vdev"}, warnings)
+
+	_, err = pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Len(warnings, 1)
+}
+
+func TestLogDevice(t *testing.T) {
+	assert := require.New(t)
+
+	var notes []string
+	defer func(a func(string, ...interface{})) { Advisef = a }(Advisef)
+	Advisef = func(format string, v ...interface{}) {
+		notes = append(notes, fmt.Sprintf(format, v...))
+	}
+
+	input := []byte(`NAME     PROPERTY  VALUE       SOURCE
+tank     type      filesystem  -
+tank     logbias   throughput  local
+tank     sync      standard    default
+tank/db  type      filesystem  -
+tank/db  logbias   throughput  inherited from tank
+tank/db  sync      always      local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+	pool := pools["tank"]
+
+	vdevs, err := zpoolStatusParse([]byte(`  pool: tank
+ state: ONLINE
+config:
+
+	NAME              STATE     READ WRITE CKSUM
+	tank              ONLINE       0     0     0
+	  mirror-0        ONLINE       0     0     0
+	    /dev/sda      ONLINE       0     0     0
+	    /dev/sdb      ONLINE       0     0     0
+	logs
+	  /dev/nvme0n1    ONLINE       0     0     0
+
+errors: No known data errors
+`))
+	assert.NoError(err)
+	pool.Vdevs = vdevs["tank"]
+
+	cmdline, err := pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	assert.Equal("zpool create -d -O logbias=throughput tank mirror /dev/sda /dev/sdb log /dev/nvme0n1", strings.Join(cmdline, " "))
+	cmdline, err = pool.CreateDatasetCommand("tank/db", nil)
+	assert.NoError(err)
+	assert.Equal("zfs create -o sync=always tank/db", strings.Join(cmdline, " "))
+	assert.Empty(notes)
+
+	pool.Vdevs.Log = nil
+	_, err = pool.CreatePoolCommand(nil)
+	assert.NoError(err)
+	_, err = pool.CreateDatasetCommand("tank/db", nil)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"tank sets logbias=throughput, but pool tank has no log vdev",
+		"tank/db sets sync=always, but pool tank has no log vdev to absorb its synchronous writes",
+	}, notes)
+}
+
+func TestZpoolStatusParseFailures(t *testing.T) {
+	assert := require.New(t)
+
+	cases := map[string]string{
+		"duplicate zpool found: foo": `  pool: foo
+  pool: foo`,
+		"unexpected config: NAME  STATE  READ  WRITE  CKSUM": `	NAME  STATE  READ  WRITE  CKSUM`,
+		"foo unsupported vdev: replacing-0": `  pool: foo
+	NAME  STATE  READ  WRITE  CKSUM
+	foo   ONLINE  0  0  0
+	  mirror-0  ONLINE  0  0  0
+	    replacing-0  ONLINE  0  0  0
+	      /dev/sda  ONLINE  0  0  0
+	      /dev/sdb  ONLINE  0  0  0`,
+		"foo unsupported vdev section: bogus": `  pool: foo
+	NAME  STATE  READ  WRITE  CKSUM
+	foo   ONLINE  0  0  0
+	bogus
+	  /dev/sda  ONLINE  0  0  0`,
+		"foo unsupported vdev: /dev/sdb": `  pool: foo
+	NAME  STATE  READ  WRITE  CKSUM
+	foo   ONLINE  0  0  0
+	  /dev/sda  ONLINE  0  0  0
+	    /dev/sdb  ONLINE  0  0  0`,
+	}
+
+	for out, in := range cases {
+		_, err := zpoolStatusParse([]byte(in))
+		assert.EqualError(err, out)
+	}
+}
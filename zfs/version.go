@@ -0,0 +1,97 @@
+package zfs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version of the zfs userland, as reported by zfs version
+type Version struct {
+	Major, Minor, Patch int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is major.minor or later
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// SupportsJSON reports whether zfs get and zpool get accept -j, added in 2.3
+func (v Version) SupportsJSON() bool {
+	return v.AtLeast(2, 3)
+}
+
+var zfsVersionLine = regexp.MustCompile(`^zfs-([0-9]+)\.([0-9]+)\.([0-9]+)`)
+
+func zfsVersionRaw(r CommandRunner) ([]byte, error) {
+	return r.Run(`zfs`, `version`)
+}
+
+// Parses the userland version from the first line of zfs version output
+func zfsVersionParse(b []byte) (v Version, err error) {
+	first := strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0])
+	m := zfsVersionLine.FindStringSubmatch(first)
+	if m == nil {
+		return v, fmt.Errorf("unexpected zfs version: %s", first)
+	}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	return v, nil
+}
+
+// ZfsVersionWith runs zfs version with r
+func ZfsVersionWith(r CommandRunner) (Version, error) {
+	b, err := zfsVersionRaw(r)
+	if err != nil {
+		return Version{}, err
+	}
+	return zfsVersionParse(b)
+}
+
+var zfsVersion = cachedVersion(DefaultRunner)
+
+// ZfsVersion returns the version of the installed zfs, which is only run
+// once per process. zfs releases before 0.8 lack zfs version and return an error.
+func ZfsVersion() (Version, error) {
+	return zfsVersion()
+}
+
+// Returns ZfsVersionWith(r), running zfs version with r only on the first call
+func cachedVersion(r CommandRunner) func() (Version, error) {
+	var once sync.Once
+	var v Version
+	var err error
+	return func() (Version, error) {
+		once.Do(func() { v, err = ZfsVersionWith(r) })
+		return v, err
+	}
+}
+
+// Warns about each feature enabled on pools that zfs v doesn't support, such
+// as dRAID before 2.1, as zpool create would reject it
+func warnUnsupportedFeatures(pools map[string]*Pool, v Version) {
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, prop := range propertyList(pools[name].Properties) {
+			if !prop.isFeature() || prop.localValue == FeatureDisabled {
+				continue
+			}
+			if min, ok := featureVersions[strings.TrimPrefix(prop.Name, "feature@")]; ok && !v.AtLeast(min[0], min[1]) {
+				Warnf("%s: %s requires zfs %d.%d, but zfs %s is installed", name, prop.Name, min[0], min[1], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package zfs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZfsVersion(t *testing.T) {
+	assert := require.New(t)
+
+	cases := map[string]Version{
+		"zfs-2.2.2-1\nzfs-kmod-2.2.2-1\n":                               {2, 2, 2},
+		"zfs-2.1.5-1ubuntu6~22.04.1\nzfs-kmod-2.1.5-1ubuntu6~22.04.1\n": {2, 1, 5},
+		"zfs-2.3.0-rc3\nzfs-kmod-2.2.6-1\n":                             {2, 3, 0},
+		"zfs-0.8.3-1ubuntu12.17\nzfs-kmod-0.8.3-1ubuntu12.17\n":         {0, 8, 3},
+	}
+	for in, out := range cases {
+		v, err := ZfsVersionWith(fakeRunner{"zfs version": in})
+		assert.NoError(err)
+		assert.Equal(out, v)
+	}
+
+	_, err := zfsVersionParse([]byte("unrecognized command 'version'\n"))
+	assert.EqualError(err, "unexpected zfs version: unrecognized command 'version'")
+
+	assert.True(Version{2, 3, 0}.SupportsJSON())
+	assert.True(Version{3, 0, 0}.SupportsJSON())
+	assert.False(Version{2, 2, 9}.SupportsJSON())
+	assert.True(Version{2, 2, 0}.AtLeast(2, 2))
+	assert.False(Version{1, 9, 0}.AtLeast(2, 0))
+	assert.Equal("2.1.5", Version{2, 1, 5}.String())
+}
+
+func TestUnsupportedFeatures(t *testing.T) {
+	assert := require.New(t)
+
+	var warnings []string
+	defer func(w func(string, ...interface{})) { Warnf = w }(Warnf)
+	Warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	runner := fakeRunner{
+		"zfs version": "zfs-2.0.7-1\nzfs-kmod-2.0.7-1\n",
+		"zpool get all": `NAME  PROPERTY               VALUE     SOURCE
+tank  feature@draid          enabled   local
+tank  feature@block_cloning  disabled  local
+tank  feature@zstd_compress  active    local
+tank  feature@async_destroy  enabled   local
+`,
+		"zfs get all": `NAME  PROPERTY  VALUE       SOURCE
+tank  type      filesystem  -
+`,
+	}
+	in := RunnerInput(runner)
+	in.ZpoolStatus = nil
+	_, err := ImportedPoolsFrom(in)
+	assert.NoError(err)
+	assert.Equal([]string{"tank: feature@draid requires zfs 2.1, but zfs 2.0.7 is installed"}, warnings)
+
+	// Nothing is checked without a version
+	warnings = nil
+	delete(runner, "zfs version")
+	in = RunnerInput(runner)
+	in.ZpoolStatus = nil
+	_, err = ImportedPoolsFrom(in)
+	assert.NoError(err)
+	assert.Empty(warnings)
+}
@@ -0,0 +1,52 @@
+package zfs
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parses a size as printed by zfs get, either in bytes or with a 1024-based
+// suffix such as 10.3G. Returns false if the value is not a size.
+func parseSize(value string) (float64, bool) {
+	const suffixes = "BKMGTPEZ"
+	value = strings.TrimSuffix(value, "B")
+	mult := 1.0
+	if n := len(value); n > 0 {
+		if i := strings.IndexByte(suffixes, value[n-1]); i >= 0 {
+			value = value[:n-1]
+			for ; i > 0; i-- {
+				mult *= 1024
+			}
+		}
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return 0, false
+	}
+	return f * mult, true
+}
+
+// A volume is sparse if it reserves less space than its volsize. zfs create
+// without -s sets refreservation to volsize plus metadata overhead, so a
+// refreservation of none, or any value below volsize, can only come from -s
+// or a later zfs set. Either way -s reproduces it, since an explicit
+// refreservation is still emitted as -o. Unparseable sizes are assumed thick.
+func (d *Dataset) isSparse() bool {
+	refres, ok := d.Properties["refreservation"]
+	if !ok {
+		return false
+	}
+	if refres.Value() == "none" {
+		return true
+	}
+	volsize, ok := d.Properties["volsize"]
+	if !ok {
+		return false
+	}
+	r, ok := parseSize(refres.Value())
+	if !ok {
+		return false
+	}
+	v, ok := parseSize(volsize.Value())
+	return ok && r < v
+}
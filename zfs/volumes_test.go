@@ -0,0 +1,65 @@
+package zfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	assert := require.New(t)
+
+	cases := map[string]float64{
+		"0":       0,
+		"512":     512,
+		"16K":     16 * 1024,
+		"10.3G":   10.3 * 1024 * 1024 * 1024,
+		"1T":      1024 * 1024 * 1024 * 1024,
+		"1.50MB":  1.5 * 1024 * 1024,
+		"1099511": 1099511,
+	}
+	for in, out := range cases {
+		size, ok := parseSize(in)
+		assert.True(ok, in)
+		assert.InDelta(out, size, 1, in)
+	}
+
+	for _, in := range []string{"", "none", "-", "auto", "G"} {
+		_, ok := parseSize(in)
+		assert.False(ok, in)
+	}
+}
+
+func TestCreateSparseVolumeCommand(t *testing.T) {
+	assert := require.New(t)
+
+	input := []byte(`NAME        PROPERTY        VALUE       SOURCE
+tank        type            filesystem  -
+tank/thick  type            volume      -
+tank/thick  volsize         10G         local
+tank/thick  volblocksize    16K         -
+tank/thick  refreservation  10.3G       local
+tank/thin   type            volume      -
+tank/thin   volsize         10G         local
+tank/thin   volblocksize    16K         -
+tank/thin   refreservation  none        default
+tank/part   type            volume      -
+tank/part   volsize         10G         local
+tank/part   volblocksize    16K         -
+tank/part   refreservation  2G          local`)
+
+	pools, err := parseGetAll(input, map[string]map[string]*Property{"tank": {}})
+	assert.EqualError(err, "end of input")
+
+	expected := map[string]string{
+		"tank/thick": "zfs create -V 10G -b 16K -o refreservation=10.3G tank/thick",
+		"tank/thin":  "zfs create -s -V 10G -b 16K tank/thin",
+		"tank/part":  "zfs create -s -V 10G -b 16K -o refreservation=2G tank/part",
+	}
+	for name, out := range expected {
+		cmdline, err := pools["tank"].CreateDatasetCommand(name, nil)
+		assert.NoError(err)
+		assert.Equal(out, strings.Join(cmdline, " "), name)
+	}
+}
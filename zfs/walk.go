@@ -0,0 +1,23 @@
+package zfs
+
+// WalkDatasets calls fn for each dataset of p in Datasets.Ordered order, in
+// which every dataset follows its parent, stopping at the first error
+func (p *Pool) WalkDatasets(fn func(*Dataset) error) error {
+	for _, d := range p.Datasets.Ordered {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkProperties calls fn for each property of d sorted by name, stopping at
+// the first error
+func (d *Dataset) WalkProperties(fn func(*Property) error) error {
+	for _, prop := range propertyList(d.Properties) {
+		if err := fn(prop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
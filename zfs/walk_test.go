@@ -0,0 +1,60 @@
+package zfs
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalk(t *testing.T) {
+	assert := require.New(t)
+
+	pools, err := ParseProperties([]byte(`NAME         PROPERTY     VALUE       SOURCE
+tank/a/b     type         filesystem  -
+tank/c       type         filesystem  -
+tank/a       type         filesystem  -
+tank/a       compression  lz4         local
+tank/a       atime        off         local
+tank/a       xattr        sa          local
+tank         type         filesystem  -`), []byte(`NAME  PROPERTY               VALUE    SOURCE
+tank  feature@async_destroy  enabled  local`))
+	assert.NoError(err)
+	p := pools["tank"]
+
+	seen := map[string]bool{}
+	assert.NoError(p.WalkDatasets(func(d *Dataset) error {
+		if parent := path.Dir(d.Name); parent != "." {
+			assert.True(seen[parent], "%s visited before %s", d.Name, parent)
+		}
+		seen[d.Name] = true
+		return nil
+	}))
+	assert.Len(seen, 4)
+
+	stop := errors.New("stop")
+	var visited []string
+	assert.Equal(stop, p.WalkDatasets(func(d *Dataset) error {
+		visited = append(visited, d.Name)
+		return stop
+	}))
+	assert.Equal([]string{"tank"}, visited)
+
+	var names []string
+	assert.NoError(p.Datasets.Index["tank/a"].WalkProperties(func(prop *Property) error {
+		names = append(names, prop.Name)
+		return nil
+	}))
+	assert.Equal([]string{"atime", "compression", "type", "xattr"}, names)
+
+	names = nil
+	assert.Equal(stop, p.Datasets.Index["tank/a"].WalkProperties(func(prop *Property) error {
+		names = append(names, prop.Name)
+		if prop.Name == "compression" {
+			return stop
+		}
+		return nil
+	}))
+	assert.Equal([]string{"atime", "compression"}, names)
+}
@@ -0,0 +1,19 @@
+package zfs
+
+import "log"
+
+// Warnf reports conditions that don't prevent inference but may affect how
+// faithfully the generated commands reproduce a pool. Replace it to redirect
+// or silence warnings.
+var Warnf = func(format string, v ...interface{}) {
+	log.Printf("warning: "+format, v...)
+}
+
+// Omitf explains why a property was left out of a generated command. It
+// discards everything unless replaced, as zinfer --verbose does.
+var Omitf = func(format string, v ...interface{}) {}
+
+// Advisef notes settings that are reproduced as they are but may not work as
+// intended, such as logbias=throughput on a pool without a log vdev. It
+// discards everything unless replaced, as zinfer --verbose does.
+var Advisef = func(format string, v ...interface{}) {}
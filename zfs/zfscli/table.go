@@ -0,0 +1,132 @@
+package zfscli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var header = regexp.MustCompile(`(\w+)(\s*)`)
+
+// MaxLineLength is the longest line NewLineScanner accepts. A zfs user
+// property value alone may be 8KiB, well beyond it only in malformed input.
+const MaxLineLength = 1 << 20
+
+// NewLineScanner returns a scanner over the lines of r, split as
+// bytes.Split(b, "\n") would, so that input ending in a newline has a final
+// empty line. Lines may be up to MaxLineLength long.
+func NewLineScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, MaxLineLength)
+	s.Split(splitLines)
+	return s
+}
+
+func splitLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), append([]byte{}, data...), bufio.ErrFinalToken
+	}
+	return 0, nil, nil
+}
+
+func ScanTable(raw []byte, each func(i int, row []string) error) error {
+	return ScanTableReader(bytes.NewReader(raw), each)
+}
+
+// ScanTableReader is ScanTable reading one line at a time from r
+func ScanTableReader(r io.Reader, each func(i int, row []string) error) error {
+	s := NewLineScanner(r)
+	if !s.Scan() {
+		return s.Err()
+	}
+
+	first := s.Bytes()
+	m := header.FindAllSubmatch(first, -1)
+	if m == nil {
+		return fmt.Errorf("unable to parse header: %s", first)
+	}
+
+	widths := make([]int, len(m))
+	names := make([]string, len(m))
+	for i, field := range m {
+		w := len(field[2])
+		if w != 0 {
+			w += len(field[1])
+		}
+		widths[i] = w
+		names[i] = string(field[1])
+	}
+
+	if err := each(0, append([]string(nil), names...)); err != nil {
+		return err
+	}
+
+	for i := 1; s.Scan(); i++ {
+		row := make([]string, len(names))
+
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			row = nil
+		} else {
+			for f, w := range widths {
+				if w != 0 && w < len(line) {
+					row[f] = string(line[0:w])
+					line = line[w:]
+				} else {
+					// Short rows leave the remaining fields empty
+					row[f] = string(line[0:])
+					line = nil
+				}
+				row[f] = strings.TrimSpace(row[f])
+			}
+		}
+
+		if err := each(i, row); err != nil {
+			return err
+		}
+	}
+
+	return s.Err()
+}
+
+// IsTabSeparated reports whether line is a row of -H output with n fields
+func IsTabSeparated(line []byte, n int) bool {
+	return len(bytes.Split(line, []byte{'\t'})) == n
+}
+
+// ScanTabs is ScanTable for -H output, which omits the header and separates
+// fields with single tabs. names is passed in place of the header as row 0.
+func ScanTabs(raw []byte, names []string, each func(i int, row []string) error) error {
+	return ScanTabsReader(bytes.NewReader(raw), names, each)
+}
+
+// ScanTabsReader is ScanTabs reading one line at a time from r
+func ScanTabsReader(r io.Reader, names []string, each func(i int, row []string) error) error {
+	if err := each(0, names); err != nil {
+		return err
+	}
+
+	s := NewLineScanner(r)
+	for i := 1; s.Scan(); i++ {
+		l := s.Bytes()
+		var row []string
+		if len(bytes.TrimSpace(l)) != 0 {
+			row = strings.Split(strings.TrimRight(string(l), "\r"), "\t")
+			if len(row) != len(names) {
+				return fmt.Errorf("expected %d tab-separated fields: %s", len(names), l)
+			}
+		}
+
+		if err := each(i, row); err != nil {
+			return err
+		}
+	}
+
+	return s.Err()
+}
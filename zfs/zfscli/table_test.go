@@ -0,0 +1,74 @@
+package zfscli
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanTable(t *testing.T) {
+	assert := require.New(t)
+
+	expected := [][]string{
+		{"NAME", "PROPERTY", "VALUE", "SOURCE"},
+		{"foo", "bar", "x  y", "z"},
+		{"fizz", "buzz", "a", "bcdefgh"},
+		{"short", "row", "", ""},
+		nil,
+	}
+
+	err := ScanTable([]byte(""+
+		"NAME   PROPERTY   VALUE   SOURCE\n"+
+		"foo    bar        x  y    z\n"+
+		"fizz   buzz       a       bcdefgh\n"+
+		"short  row\n",
+	), func(i int, row []string) error {
+		assert.Equal(expected[i], row)
+		return nil
+	})
+	assert.NoError(err)
+}
+
+func TestScanTabs(t *testing.T) {
+	assert := require.New(t)
+
+	expected := [][]string{
+		{"NAME", "PROPERTY", "VALUE", "SOURCE"},
+		{"foo", "bar", "x  y", "z"},
+		{"fizz", "buzz", "", "inherited from foo"},
+		nil,
+	}
+
+	input := []byte("foo\tbar\tx  y\tz\nfizz\tbuzz\t\tinherited from foo\n")
+	assert.True(IsTabSeparated(input[:bytes.IndexByte(input, '\n')], 4))
+	assert.False(IsTabSeparated([]byte("NAME   PROPERTY   VALUE   SOURCE"), 4))
+
+	err := ScanTabs(input, expected[0], func(i int, row []string) error {
+		assert.Equal(expected[i], row)
+		return nil
+	})
+	assert.NoError(err)
+
+	err = ScanTabs([]byte("foo\tbar\n"), expected[0], func(int, []string) error { return nil })
+	assert.EqualError(err, "expected 4 tab-separated fields: foo\tbar")
+}
+
+func TestLongLines(t *testing.T) {
+	assert := require.New(t)
+
+	value := strings.Repeat("x", 100000)
+	err := ScanTabs([]byte("foo\tbar\t"+value+"\tlocal\n"), []string{"NAME", "PROPERTY", "VALUE", "SOURCE"}, func(i int, row []string) error {
+		if i == 1 {
+			assert.Len(row[2], len(value))
+		}
+		return nil
+	})
+	assert.NoError(err)
+
+	s := NewLineScanner(strings.NewReader(strings.Repeat("x", MaxLineLength+1)))
+	assert.False(s.Scan())
+	assert.ErrorIs(s.Err(), bufio.ErrTooLong)
+}